@@ -2,6 +2,7 @@ package aimodels
 
 import (
 	"github.com/Back-to-code/go-llm"
+	"github.com/Back-to-code/go-llm/anthropic"
 	"github.com/Back-to-code/go-llm/googleaistudio"
 	"github.com/Back-to-code/go-llm/inception"
 	"github.com/Back-to-code/go-llm/openai"
@@ -24,17 +25,19 @@ var (
 	// Should be used if the mini model is not good enough.
 	// By deafult the models use the lowest option of thinking (so no thinking in most cases), the level of thinking can be enabled inside llm.Options
 	// = PRICY - ULTRA EXPENSIVE
-	ChatGpt5   = register("gpt-5.4", &openai.Provider{})
-	Gemini3Pro = register("gemini-3.1-pro-preview", &googleaistudio.Provider{})
-	Best       = ChatGpt5 // <- Deafult
+	ChatGpt5    = register("gpt-5.4", &openai.Provider{})
+	Gemini3Pro  = register("gemini-3.1-pro-preview", &googleaistudio.Provider{})
+	ClaudeOpus4 = register("claude-opus-4-5", &anthropic.Provider{})
+	Best        = ChatGpt5 // <- Deafult
 
 	// Mini models.
 	// When the nano model is not good enough but the good model is somewhat too expensive
 	// This is most of the time a good middleground
 	// = CHEAP
-	ChatGpt5Mini = register("gpt-5.4-mini", &openai.Provider{})
-	Gemini3Flash = register("gemini-3-flash-preview", &googleaistudio.Provider{})
-	Mini         = ChatGpt5Mini // <- Deafult
+	ChatGpt5Mini  = register("gpt-5.4-mini", &openai.Provider{})
+	Gemini3Flash  = register("gemini-3-flash-preview", &googleaistudio.Provider{})
+	ClaudeSonnet4 = register("claude-sonnet-4-5", &anthropic.Provider{})
+	Mini          = ChatGpt5Mini // <- Deafult
 
 	// Default nano model.
 	// For basic llm tasks mainly smart parttern matching tasks are these models perfect for
@@ -43,5 +46,6 @@ var (
 	ChatGpt5Nano = register("gpt-5-nano", &openai.Provider{})
 	Gemini2Flash = register("gemini-2.0-flash", &googleaistudio.Provider{})
 	Mercury2     = register("mercury-2", &inception.Provider{})
+	ClaudeHaiku4 = register("claude-haiku-4-5", &anthropic.Provider{})
 	Nano         = ChatGpt5Nano // <- Deafult
 )
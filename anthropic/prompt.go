@@ -0,0 +1,367 @@
+package anthropic
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Back-to-code/go-llm"
+)
+
+type Message struct {
+	Role    string         `json:"role"` // "user", "assistant"
+	Content []ContentBlock `json:"content"`
+}
+
+type ContentBlock struct {
+	Type string `json:"type"` // "text", "image", "document", "tool_use", "tool_result", "thinking", "redacted_thinking"
+	Text string `json:"text,omitempty"`
+
+	// image and document
+	Source *Source `json:"source,omitempty"`
+
+	// tool_use
+	Id    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseId string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+
+	// thinking and redacted_thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+type Source struct {
+	Type      string `json:"type"` // "base64", "url" or "text"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
+}
+
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// ToolChoice of a request, type is "auto", "any", "tool" or "none"
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"` // The tool to call for type "tool"
+
+	DisableParallelToolUse bool `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type OutputFormat struct {
+	Type   string          `json:"type"` // "json_schema"
+	Schema json.RawMessage `json:"schema"`
+}
+
+type InferenceRequest struct {
+	Model        string         `json:"model"`
+	System       []ContentBlock `json:"system,omitempty"`
+	Messages     []Message      `json:"messages"`
+	MaxTokens    int            `json:"max_tokens"`
+	Stream       bool           `json:"stream,omitempty"`
+	Tools        []Tool         `json:"tools,omitempty"`
+	ToolChoice   *ToolChoice    `json:"tool_choice,omitempty"`
+	Thinking     *Thinking      `json:"thinking,omitempty"`
+	OutputFormat *OutputFormat  `json:"output_format,omitempty"`
+
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	StopSequences []string `json:"stop_sequences,omitempty"`
+}
+
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+// toTokenUsage converts the usage, anthropic does not include cached tokens in
+// input_tokens while the other providers do so they are added here.
+func (u Usage) toTokenUsage() llm.TokenUsage {
+	return llm.TokenUsage{
+		InputTokens:       u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens,
+		OutputTokens:      u.OutputTokens,
+		CachedInputTokens: u.CacheReadInputTokens,
+	}
+}
+
+const structuredOutputsBeta = "structured-outputs-2025-11-13"
+
+func createRequest(stream bool, model string, messages []llm.Message, options llm.Options) (io.ReadCloser, error) {
+	bodyMessages, system, err := convertMessages(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	reqBody := InferenceRequest{
+		Model:    model,
+		System:   system,
+		Messages: bodyMessages,
+		Stream:   stream,
+		Tools:    convertTools(options.Tools),
+	}
+	reqBody.Thinking, reqBody.MaxTokens = getThinking(options.Thinking, options.MaxTokens)
+	if len(options.Tools) > 0 {
+		reqBody.ToolChoice = convertToolChoice(options.ToolChoice)
+		if options.ParallelToolCalls != nil && !*options.ParallelToolCalls && options.ToolChoice.Mode != llm.ToolChoiceNone {
+			if reqBody.ToolChoice == nil {
+				reqBody.ToolChoice = &ToolChoice{Type: "auto"}
+			}
+			reqBody.ToolChoice.DisableParallelToolUse = true
+		}
+	}
+	if reqBody.Thinking != nil && options.ToolChoice.Forced() {
+		return nil, errors.New("anthropic can not force a tool call with extended thinking")
+	}
+
+	// Anthropic has no seed or penalties, with extended thinking the temperature
+	// can not be changed and top_p must be between 0.95 and 1
+	reqBody.StopSequences = options.StopSequences
+	if reqBody.Thinking == nil {
+		reqBody.Temperature = options.Temperature
+		reqBody.TopP = options.TopP
+	} else if options.TopP != nil && *options.TopP >= 0.95 {
+		reqBody.TopP = options.TopP
+	}
+
+	var betas []string
+	if options.ResponseFormat == llm.ResponseFormatJsonSchema {
+		reqBody.OutputFormat = &OutputFormat{
+			Type:   "json_schema",
+			Schema: options.JsonSchema.Schema,
+		}
+		betas = append(betas, structuredOutputsBeta)
+	}
+
+	resp, err := newRequest("/v1/messages", reqBody, betas, options.Timeout, options.Ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send messages request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fullResponse, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, llm.NewAPIError("anthropic", resp, fullResponse)
+	}
+
+	return resp.Body, nil
+}
+
+type Provider struct{}
+
+var _ llm.Provider = &Provider{}
+
+// SupportsStructuredOutput returns false as the messages API has no plain json
+// mode, json output is only available through a json schema
+func (*Provider) SupportsStructuredOutput() bool {
+	return false
+}
+
+func (*Provider) SupportsJsonSchema() bool {
+	return true
+}
+
+func (*Provider) SupportsStreaming() bool {
+	return true
+}
+
+func (*Provider) SupportsTools() bool {
+	return true
+}
+
+// SupportsPart returns true for images and documents, audio is not supported
+func (*Provider) SupportsPart(partType llm.PartType) bool {
+	return partType == llm.PartText || partType == llm.PartImage || partType == llm.PartFile
+}
+
+func (p *Provider) Prompt(model string, messages []llm.Message, options llm.Options) (llm.Response, error) {
+	return llm.ToolLoop{
+		Options: options,
+		Round: func(messages []llm.Message, options llm.Options) (llm.RoundResult, error) {
+			return promptRound(model, messages, options)
+		},
+	}.Run(messages)
+}
+
+// promptRound sends a single request, the tool calls in the answer are resolved by the llm.ToolLoop
+func promptRound(model string, messages []llm.Message, options llm.Options) (llm.RoundResult, error) {
+	resp, err := createRequest(false, model, messages, options)
+	if err != nil {
+		return llm.RoundResult{}, err
+	}
+	defer resp.Close()
+
+	respContent := struct {
+		Content    []ContentBlock `json:"content"`
+		StopReason string         `json:"stop_reason"`
+		Usage      Usage          `json:"usage"`
+	}{}
+	err = json.NewDecoder(resp).Decode(&respContent)
+	if err != nil {
+		return llm.RoundResult{}, fmt.Errorf("decoding response: %s", err.Error())
+	}
+
+	round, err := toRoundResult(respContent.Content, respContent.StopReason, respContent.Usage)
+	if err != nil {
+		return llm.RoundResult{}, err
+	}
+	if len(round.Message.ToolCalls) == 0 && round.Message.Content == "" && respContent.StopReason != "end_turn" {
+		return llm.RoundResult{}, errors.New("missing content, stop reason: " + respContent.StopReason)
+	}
+	return round, nil
+}
+
+func (*Provider) StreamEvents(model string, messages []llm.Message, options llm.Options) (chan llm.StreamEvent, error) {
+	resp, err := createRequest(true, model, messages, options)
+	if err != nil {
+		return nil, err
+	}
+
+	open := func(messages []llm.Message, options llm.Options) (io.ReadCloser, error) {
+		return createRequest(true, model, messages, options)
+	}
+	return llm.StreamToolLoop(resp, messages, options, open, readStream), nil
+}
+
+type streamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message *struct {
+		Usage Usage `json:"usage"`
+	} `json:"message"`
+	ContentBlock *ContentBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJson string `json:"partial_json"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *Usage          `json:"usage"`
+	Error json.RawMessage `json:"error"`
+}
+
+// readStream parses the server sent events of a messages stream, forwards
+// them as events and returns the assistant message as a round of the tool loop
+func readStream(resp io.Reader, events chan llm.StreamEvent) (llm.RoundResult, error) {
+	blocks := []ContentBlock{}
+	toolInputs := map[int]*strings.Builder{}
+	usage := Usage{}
+	stopReason := ""
+
+	reader := bufio.NewReader(resp)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				return llm.RoundResult{}, errors.New("stream ended before message_stop")
+			}
+			return llm.RoundResult{}, fmt.Errorf("reading stream: %w", err)
+		}
+
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !ok {
+			continue
+		}
+
+		event := streamEvent{}
+		err = json.Unmarshal([]byte(strings.TrimSpace(data)), &event)
+		if err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "error":
+			return llm.RoundResult{}, llm.NewAPIError("anthropic", nil, event.Error)
+		case "message_start":
+			if event.Message != nil {
+				usage = event.Message.Usage
+			}
+		case "content_block_start":
+			if event.ContentBlock == nil {
+				continue
+			}
+			for len(blocks) <= event.Index {
+				blocks = append(blocks, ContentBlock{})
+			}
+			blocks[event.Index] = *event.ContentBlock
+
+			if event.ContentBlock.Type == "tool_use" {
+				toolInputs[event.Index] = &strings.Builder{}
+				events <- llm.StreamEvent{Kind: llm.StreamToolCallStarted, ToolCall: &llm.StreamToolCall{
+					Index: event.Index,
+					Id:    event.ContentBlock.Id,
+					Name:  event.ContentBlock.Name,
+				}}
+			}
+		case "content_block_delta":
+			if event.Index >= len(blocks) {
+				continue
+			}
+			block := &blocks[event.Index]
+
+			switch event.Delta.Type {
+			case "text_delta":
+				block.Text += event.Delta.Text
+				events <- llm.StreamEvent{Kind: llm.StreamText, Text: event.Delta.Text}
+			case "thinking_delta":
+				block.Thinking += event.Delta.Thinking
+				events <- llm.StreamEvent{Kind: llm.StreamReasoning, Text: event.Delta.Thinking}
+			case "signature_delta":
+				block.Signature += event.Delta.Signature
+			case "input_json_delta":
+				if input, ok := toolInputs[event.Index]; ok {
+					input.WriteString(event.Delta.PartialJson)
+				}
+				events <- llm.StreamEvent{Kind: llm.StreamToolCallArgument, ToolCall: &llm.StreamToolCall{
+					Index:     event.Index,
+					Id:        block.Id,
+					Name:      block.Name,
+					Arguments: event.Delta.PartialJson,
+				}}
+			}
+		case "content_block_stop":
+			input, ok := toolInputs[event.Index]
+			if !ok || event.Index >= len(blocks) {
+				continue
+			}
+			block := &blocks[event.Index]
+			block.Input = json.RawMessage(input.String())
+			if len(block.Input) == 0 {
+				block.Input = json.RawMessage("{}")
+			}
+			events <- llm.StreamEvent{Kind: llm.StreamToolCallFinished, ToolCall: &llm.StreamToolCall{
+				Index:     event.Index,
+				Id:        block.Id,
+				Name:      block.Name,
+				Arguments: string(block.Input),
+			}}
+		case "message_delta":
+			if event.Usage != nil {
+				// The output tokens of message_delta are cumulative
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+			if event.Delta.StopReason != "" {
+				stopReason = event.Delta.StopReason
+				events <- llm.StreamEvent{Kind: llm.StreamFinish, FinishReason: stopReason, StopReason: toStopReason(stopReason)}
+			}
+		case "message_stop":
+			events <- llm.StreamEvent{Kind: llm.StreamUsage, Usage: usage.toTokenUsage()}
+			return toRoundResult(blocks, stopReason, usage)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+// Test the system prompt is hoisted, tool_use blocks are resolved and send
+// back as tool_result blocks and cached tokens are reported.
+func TestPromptToolUse(t *testing.T) {
+	os.Setenv("ANTHROPIC_API_KEY", "test-key")
+	defer os.Unsetenv("ANTHROPIC_API_KEY")
+
+	var requests []InferenceRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "test-key" || r.Header.Get("Anthropic-Version") == "" {
+			t.Errorf("missing authentication headers")
+		}
+
+		var req InferenceRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			w.Write([]byte(`{"content":[{"type":"thinking","thinking":"hmm","signature":"sig"},{"type":"text","text":"Let me check."},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Amsterdam"}}],"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5,"cache_read_input_tokens":100}}`))
+			return
+		}
+		w.Write([]byte(`{"content":[{"type":"text","text":"It is sunny."}],"stop_reason":"end_turn","usage":{"input_tokens":20,"output_tokens":4}}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	var gotArgs string
+	tools := []llm.Tool{{
+		Type:     "function",
+		Function: llm.FunctionDef{Name: "get_weather"},
+		Resolver: func(args json.RawMessage) (any, error) {
+			gotArgs = string(args)
+			return "sunny", nil
+		},
+	}}
+
+	p := &Provider{}
+	resp, err := p.Prompt("claude-test", []llm.Message{llm.System("be brief"), llm.User("weather?")}, llm.Options{Tools: tools, Thinking: llm.LowThinking})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if resp.Value != "It is sunny." {
+		t.Errorf("Value = %q", resp.Value)
+	}
+	if gotArgs != `{"city":"Amsterdam"}` {
+		t.Errorf("wrong args threaded to resolver: %q", gotArgs)
+	}
+	want := llm.TokenUsage{InputTokens: 130, OutputTokens: 9, CachedInputTokens: 100}
+	if resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+
+	first := requests[0]
+	if len(first.System) != 1 || first.System[0].Text != "be brief" || len(first.Messages) != 1 {
+		t.Errorf("system prompt was not hoisted: %+v", first)
+	}
+	if first.Thinking == nil || first.Thinking.BudgetTokens >= first.MaxTokens {
+		t.Errorf("expected a thinking budget below max_tokens, got %+v max_tokens %d", first.Thinking, first.MaxTokens)
+	}
+
+	followUp := requests[1].Messages
+	if len(followUp) != 3 {
+		t.Fatalf("expected user, assistant and tool result messages, got %d", len(followUp))
+	}
+	if blocks := followUp[1].Content; len(blocks) != 3 || blocks[0].Type != "thinking" || blocks[0].Signature != "sig" {
+		t.Errorf("assistant turn was not send back unchanged: %+v", blocks)
+	}
+	if result := followUp[2].Content[0]; result.Type != "tool_result" || result.ToolUseId != "toolu_1" || result.Content != `"sunny"` {
+		t.Errorf("unexpected tool result %+v", result)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	os.Setenv("ANTHROPIC_API_KEY", "test-key")
+	defer os.Unsetenv("ANTHROPIC_API_KEY")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(strings.Join([]string{
+			"event: message_start",
+			`data: {"type":"message_start","message":{"usage":{"input_tokens":12,"output_tokens":1}}}`,
+			"",
+			"event: content_block_start",
+			`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			"",
+			"event: ping",
+			`data: {"type":"ping"}`,
+			"",
+			"event: content_block_delta",
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+			"",
+			"event: content_block_delta",
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there"}}`,
+			"",
+			"event: content_block_stop",
+			`data: {"type":"content_block_stop","index":0}`,
+			"",
+			"event: message_delta",
+			`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":6}}`,
+			"",
+			"event: message_stop",
+			`data: {"type":"message_stop"}`,
+			"",
+		}, "\n")))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	messages := []llm.Message{llm.User("hi")}
+	events, err := (&Provider{}).StreamEvents("claude-test", messages, llm.Options{})
+	if err != nil {
+		t.Fatalf("StreamEvents returned error: %v", err)
+	}
+	resp, err := llm.CollectStream(messages, events)
+	if err != nil {
+		t.Fatalf("stream reported error: %v", err)
+	}
+	if resp.Value != "Hello there" {
+		t.Errorf("Value = %q", resp.Value)
+	}
+	if resp.Usage.InputTokens != 12 || resp.Usage.OutputTokens != 6 {
+		t.Errorf("unexpected usage %+v", resp.Usage)
+	}
+}
+
+// Test images and PDF documents are converted to source blocks.
+func TestConvertMessagesParts(t *testing.T) {
+	message := llm.UserWithParts("triage these",
+		llm.ImageURLPart("https://example.com/scan.png"),
+		llm.FilePart("invoice.pdf", []byte("pdf"), "application/pdf"),
+	)
+	result, _, err := convertMessages([]llm.Message{message})
+	if err != nil {
+		t.Fatalf("convertMessages returned error: %v", err)
+	}
+
+	blocks := result[0].Content
+	if len(blocks) != 3 || blocks[0].Text != "triage these" {
+		t.Fatalf("unexpected blocks %+v", blocks)
+	}
+	if blocks[1].Type != "image" || blocks[1].Source.Type != "url" || blocks[1].Source.Url != "https://example.com/scan.png" {
+		t.Errorf("unexpected image block %+v", blocks[1].Source)
+	}
+	if blocks[2].Type != "document" || blocks[2].Source.Type != "base64" || blocks[2].Source.MediaType != "application/pdf" || blocks[2].Source.Data != "cGRm" {
+		t.Errorf("unexpected document block %+v", blocks[2].Source)
+	}
+
+	_, _, err = convertMessages([]llm.Message{llm.UserWithFile("", "sheet.xlsx", []byte("x"), "application/vnd.ms-excel")})
+	if err == nil {
+		t.Errorf("expected unsupported document types to be rejected")
+	}
+}
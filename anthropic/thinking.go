@@ -0,0 +1,44 @@
+package anthropic
+
+import "github.com/Back-to-code/go-llm"
+
+const (
+	defaultMaxTokens  = 8_192
+	minThinkingBudget = 1_024
+)
+
+type Thinking struct {
+	Type         string `json:"type"` // "enabled"
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+var thinkingBudgets = map[llm.Thinking]int{
+	llm.MinimalThinking: 1_024,
+	llm.LowThinking:     2_048,
+	llm.MediumThinking:  8_192,
+	llm.HighThinking:    24_576,
+}
+
+// getThinking maps the thinking level to an extended thinking budget and
+// returns the max_tokens to send, which must always be larger than the budget
+func getThinking(thinking llm.Thinking, maxTokens int) (*Thinking, int) {
+	budget, ok := thinkingBudgets[thinking]
+	if !ok {
+		if maxTokens <= 0 {
+			maxTokens = defaultMaxTokens
+		}
+		return nil, maxTokens
+	}
+
+	if maxTokens <= 0 {
+		// Leave the same amount of room for the answer as without thinking
+		return &Thinking{Type: "enabled", BudgetTokens: budget}, budget + defaultMaxTokens
+	}
+
+	// The caller limited the output, the thinking budget is part of that limit
+	budget = min(budget, maxTokens/2)
+	if budget < minThinkingBudget {
+		return nil, maxTokens
+	}
+	return &Thinking{Type: "enabled", BudgetTokens: budget}, maxTokens
+}
@@ -0,0 +1,227 @@
+package anthropic
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Back-to-code/go-llm"
+)
+
+// convertTools transforms the common llm.Tool definitions into anthropic tools
+func convertTools(tools []llm.Tool) []Tool {
+	if len(tools) == 0 {
+		return nil
+	}
+
+	result := make([]Tool, len(tools))
+	for i, tool := range tools {
+		inputSchema := tool.Function.Parameters
+		if len(inputSchema) == 0 {
+			inputSchema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		result[i] = Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: inputSchema,
+		}
+	}
+	return result
+}
+
+// convertToolChoice returns nil for the default, letting the model decide
+func convertToolChoice(choice llm.ToolChoice) *ToolChoice {
+	switch choice.Mode {
+	case llm.ToolChoiceAuto:
+		return &ToolChoice{Type: "auto"}
+	case llm.ToolChoiceNone:
+		return &ToolChoice{Type: "none"}
+	case llm.ToolChoiceRequired:
+		return &ToolChoice{Type: "any"}
+	case llm.ToolChoiceFunction:
+		return &ToolChoice{Type: "tool", Name: choice.Function}
+	}
+	return nil
+}
+
+// convertMessages transforms the common llm.Message slice into anthropic
+// messages, system messages are hoisted into the separate system blocks.
+func convertMessages(messages []llm.Message) (result []Message, system []ContentBlock, err error) {
+	for _, message := range messages {
+		switch message.Role {
+		case "system":
+			system = append(system, ContentBlock{Type: "text", Text: message.Content})
+
+		case "user":
+			blocks := []ContentBlock{}
+			if message.Content != "" || len(message.Parts) == 0 {
+				blocks = append(blocks, ContentBlock{Type: "text", Text: message.Content})
+			}
+			for _, part := range message.Parts {
+				block, err := partBlock(part)
+				if err != nil {
+					return nil, nil, err
+				}
+				blocks = append(blocks, block)
+			}
+
+			result = append(result, Message{
+				Role:    "user",
+				Content: blocks,
+			})
+
+		case "assistant":
+			// The thinking blocks must be send back unchanged when continuing after a tool call
+			blocks, err := thinkingBlocks(message.Reasoning)
+			if err != nil {
+				return nil, nil, err
+			}
+			if message.Content != "" {
+				blocks = append(blocks, ContentBlock{Type: "text", Text: message.Content})
+			}
+			for _, toolCall := range message.ToolCalls {
+				input := json.RawMessage(toolCall.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, ContentBlock{
+					Type:  "tool_use",
+					Id:    toolCall.Id,
+					Name:  toolCall.Name,
+					Input: input,
+				})
+			}
+			if len(blocks) == 0 {
+				continue
+			}
+
+			result = append(result, Message{
+				Role:    "assistant",
+				Content: blocks,
+			})
+
+		case "tool":
+			block := ContentBlock{
+				Type:      "tool_result",
+				ToolUseId: message.ToolCallId,
+				Content:   message.Content,
+			}
+
+			// All results of one assistant turn must be in a single user message
+			if len(result) > 0 {
+				last := &result[len(result)-1]
+				if last.Role == "user" && len(last.Content) > 0 && last.Content[len(last.Content)-1].Type == "tool_result" {
+					last.Content = append(last.Content, block)
+					continue
+				}
+			}
+
+			result = append(result, Message{
+				Role:    "user",
+				Content: []ContentBlock{block},
+			})
+
+		default:
+			return nil, nil, errors.New(message.Role + " role currently not supported for anthropic")
+		}
+	}
+
+	return result, system, nil
+}
+
+func partBlock(part llm.Part) (ContentBlock, error) {
+	source := &Source{Type: "url", Url: part.URL}
+	if len(part.Data) > 0 {
+		source = &Source{Type: "base64", MediaType: part.MimeType, Data: base64.StdEncoding.EncodeToString(part.Data)}
+	}
+
+	switch part.Type {
+	case llm.PartText:
+		return ContentBlock{Type: "text", Text: part.Text}, nil
+	case llm.PartImage:
+		return ContentBlock{Type: "image", Source: source}, nil
+	case llm.PartFile:
+		if part.MimeType == "text/plain" && len(part.Data) > 0 {
+			source = &Source{Type: "text", MediaType: part.MimeType, Data: string(part.Data)}
+		} else if part.MimeType != "" && part.MimeType != "application/pdf" {
+			return ContentBlock{}, errors.New("unsupported document type " + part.MimeType)
+		}
+		return ContentBlock{Type: "document", Source: source}, nil
+	}
+	return ContentBlock{}, errors.New("unsupported part type " + string(part.Type))
+}
+
+// thinkingBlocks returns the thinking blocks stored on a message, reasoning of
+// other providers is ignored
+func thinkingBlocks(reasoning json.RawMessage) ([]ContentBlock, error) {
+	if len(reasoning) == 0 {
+		return nil, nil
+	}
+
+	blocks := []ContentBlock{}
+	err := json.Unmarshal(reasoning, &blocks)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling thinking: %w", err)
+	}
+	return slices.DeleteFunc(blocks, func(block ContentBlock) bool {
+		return block.Type != "thinking" && block.Type != "redacted_thinking"
+	}), nil
+}
+
+func textFromBlocks(blocks []ContentBlock) string {
+	var text strings.Builder
+	for _, block := range blocks {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return text.String()
+}
+
+// toRoundResult converts the content blocks of an answer into a round of the
+// tool loop, the thinking blocks are stored on a tool call message as they
+// must be send back with the tool results
+func toRoundResult(blocks []ContentBlock, stopReason string, usage Usage) (llm.RoundResult, error) {
+	round := llm.RoundResult{
+		Message:      llm.Message{Role: "assistant", Content: textFromBlocks(blocks)},
+		Usage:        usage.toTokenUsage(),
+		StopReason:   toStopReason(stopReason),
+		FinishReason: stopReason,
+	}
+	thinking := []ContentBlock{}
+	for _, block := range blocks {
+		switch block.Type {
+		case "tool_use":
+			round.Message.ToolCalls = append(round.Message.ToolCalls, llm.ToolCall{
+				Id:        block.Id,
+				Name:      block.Name,
+				Arguments: string(block.Input),
+			})
+		case "thinking", "redacted_thinking":
+			round.Reasoning += block.Thinking
+			thinking = append(thinking, block)
+		}
+	}
+	if len(thinking) > 0 && len(round.Message.ToolCalls) > 0 {
+		reasoning, err := json.Marshal(thinking)
+		if err != nil {
+			return llm.RoundResult{}, errors.New("failed to marshal thinking: " + err.Error())
+		}
+		round.Message.Reasoning = reasoning
+	}
+	return round, nil
+}
+
+// toStopReason maps the stop_reason of a message
+func toStopReason(stopReason string) llm.StopReason {
+	switch stopReason {
+	case "max_tokens":
+		return llm.StopMaxTokens
+	case "refusal":
+		return llm.StopContentFilter
+	}
+	return llm.StopCompleted
+}
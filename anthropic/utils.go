@@ -0,0 +1,54 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	apikey "github.com/Back-to-code/go-llm/apikeys"
+)
+
+// BaseURL is the Anthropic API base URL. Exported for test overrides.
+var BaseURL = "https://api.anthropic.com"
+
+const apiVersion = "2023-06-01"
+
+func newRequest(path string, body any, betas []string, timeout time.Duration, ctx context.Context) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling JSON: %v", err)
+	}
+
+	var req *http.Request
+	if ctx == nil {
+		req, err = http.NewRequest("POST", BaseURL+path, bytes.NewBuffer(jsonData))
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "POST", BaseURL+path, bytes.NewBuffer(jsonData))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	apiKey, err := apikey.Anthropic()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", apiKey)
+	req.Header.Set("Anthropic-Version", apiVersion)
+	for _, beta := range betas {
+		req.Header.Add("Anthropic-Beta", beta)
+	}
+
+	if timeout == 0 {
+		timeout = time.Second * 30
+	}
+
+	return (&http.Client{
+		Timeout: timeout,
+	}).Do(req)
+}
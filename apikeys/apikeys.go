@@ -11,6 +11,7 @@ const (
 	togetherAi     = "TOGETHER_AI_TOKEN"
 	openAi         = "OPENAI_TOKEN"
 	inception      = "INCEPTION_API_KEY"
+	anthropic      = "ANTHROPIC_API_KEY"
 )
 
 var apiKeys = []string{
@@ -18,6 +19,7 @@ var apiKeys = []string{
 	togetherAi,
 	openAi,
 	inception,
+	anthropic,
 }
 
 func getKeyFn(key string) func() (string, error) {
@@ -35,12 +37,14 @@ var GoogleAiStudio = getKeyFn(googleAiStudio)
 var TogetherAi = getKeyFn(togetherAi)
 var OpenAi = getKeyFn(openAi)
 var Inception = getKeyFn(inception)
+var Anthropic = getKeyFn(anthropic)
 
 type RequiredApiKeys struct {
 	GoogleAiStudio bool
 	TogetherAi     bool
 	OpenAi         bool
 	Inception      bool
+	Anthropic      bool
 }
 
 func AllApiKeysSet(requirements RequiredApiKeys) bool {
@@ -56,6 +60,11 @@ func AllApiKeysSet(requirements RequiredApiKeys) bool {
 	if requirements.Inception && inception == "" {
 		return false
 	}
+	if requirements.Anthropic {
+		if key, _ := Anthropic(); key == "" {
+			return false
+		}
+	}
 
 	return true
 }
@@ -2,6 +2,14 @@ package cache
 
 import "time"
 
+// Store is a cache backend, set it per model with llm.Model.CacheStore or per call with llm.Options.CacheStore
+type Store interface {
+	// Get returns ("", nil) if the key is not set or expired
+	Get(key string) (string, error)
+	// Set stores the value, if the duration is zero or negative the value is cached forever
+	Set(key, value string, duration time.Duration) error
+}
+
 // Setter sets an should set an item in the cache, if the duration is zero or negative the value is expected to be cached forever
 var Setter func(key, value string, duration time.Duration) error
 
@@ -21,3 +29,16 @@ func Set(key, value string, duration time.Duration) error {
 	}
 	return nil
 }
+
+type globalStore struct{}
+
+func (globalStore) Get(key string) (string, error) {
+	return Get(key)
+}
+
+func (globalStore) Set(key, value string, duration time.Duration) error {
+	return Set(key, value, duration)
+}
+
+// Global is the store that uses the Getter and Setter, it is used when no other store is set
+var Global Store = globalStore{}
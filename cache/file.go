@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps every value in a json file inside Dir, the files are spread
+// over sub directories named after the first 2 characters of the hashed key.
+// Expired files are removed when read and by a compaction that runs at most
+// once every CompactInterval while values are set.
+type FileStore struct {
+	Dir             string
+	CompactInterval time.Duration // Defaults to an hour, a negative value disables compaction
+
+	lock        sync.Mutex
+	lastCompact time.Time
+	compacting  bool
+}
+
+type fileEntry struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+var _ Store = &FileStore{}
+
+// NewFileStore creates dir if it does not exist yet
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir, lastCompact: time.Now()}, nil
+}
+
+func (s *FileStore) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(hash[:])
+	return filepath.Join(s.Dir, name[:2], name+".json")
+}
+
+func (s *FileStore) Get(key string) (string, error) {
+	path := s.path(key)
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var entry fileEntry
+	if json.Unmarshal(contents, &entry) != nil || entry.Key != key {
+		// A corrupt file or a hash collision, both are a miss
+		return "", nil
+	}
+	if entry.expired(time.Now()) {
+		os.Remove(path)
+		return "", nil
+	}
+	return entry.Value, nil
+}
+
+func (s *FileStore) Set(key, value string, duration time.Duration) error {
+	entry := fileEntry{Key: key, Value: value}
+	if duration > 0 {
+		entry.ExpiresAt = time.Now().Add(duration)
+	}
+	contents, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := s.path(key)
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial value
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(contents)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	s.maybeCompact()
+	return nil
+}
+
+// maybeCompact starts a compaction in the background if the last one was more than CompactInterval ago
+func (s *FileStore) maybeCompact() {
+	interval := s.CompactInterval
+	if interval == 0 {
+		interval = time.Hour
+	}
+	if interval < 0 {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.compacting || time.Since(s.lastCompact) < interval {
+		return
+	}
+	s.compacting = true
+	go func() {
+		s.Compact()
+		s.lock.Lock()
+		s.compacting = false
+		s.lastCompact = time.Now()
+		s.lock.Unlock()
+	}()
+}
+
+// Compact removes all expired values and left over temporary files
+func (s *FileStore) Compact() error {
+	now := time.Now()
+	return filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			if info, err := d.Info(); err == nil && now.Sub(info.ModTime()) > time.Hour {
+				os.Remove(path)
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var entry fileEntry
+		if json.Unmarshal(contents, &entry) != nil || entry.expired(now) {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+func (e fileEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore returned error: %v", err)
+	}
+
+	if value, err := store.Get("missing"); value != "" || err != nil {
+		t.Errorf("Get(missing) = %q, %v", value, err)
+	}
+
+	store.Set("forever", "1", 0)
+	store.Set("short", "2", time.Millisecond)
+
+	// A new store on the same directory sees the values of an earlier run
+	reopened, _ := NewFileStore(store.Dir)
+	if value, _ := reopened.Get("forever"); value != "1" {
+		t.Errorf("Get(forever) = %q", value)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if err := reopened.Compact(); err != nil {
+		t.Fatalf("Compact returned error: %v", err)
+	}
+	if _, err := os.Stat(store.path("short")); !os.IsNotExist(err) {
+		t.Errorf("expected the expired file to be removed, got %v", err)
+	}
+	if value, _ := reopened.Get("forever"); value != "1" {
+		t.Errorf("Compact removed a value that does not expire")
+	}
+
+	if filepath.Base(filepath.Dir(store.path("forever"))) != filepath.Base(store.path("forever"))[:2] {
+		t.Errorf("expected the file to be in a shard directory, got %s", store.path("forever"))
+	}
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is an in memory store that holds at most MaxEntries values, the least
+// recently used value is removed when it is full. Create one with NewLRU, the
+// zero value is an empty store without a limit.
+type LRU struct {
+	MaxEntries int // 0 means no limit
+
+	lock    sync.Mutex
+	order   *list.List // Front is the most recently used
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time // Zero if the entry does not expire
+}
+
+var _ Store = &LRU{}
+
+func NewLRU(maxEntries int) *LRU {
+	return &LRU{
+		MaxEntries: maxEntries,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+func (c *LRU) Get(key string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return "", nil
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return "", nil
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, nil
+}
+
+func (c *LRU) Set(key, value string, duration time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var expiresAt time.Time
+	if duration > 0 {
+		expiresAt = time.Now().Add(duration)
+	}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &lruEntry{key: key, value: value, expiresAt: expiresAt}
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	if c.entries == nil {
+		c.order = list.New()
+		c.entries = map[string]*list.Element{}
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.MaxEntries > 0 && c.order.Len() > c.MaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of values in the cache, including expired values that were not removed yet
+func (c *LRU) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", "1", 0)
+	c.Set("b", "2", 0)
+
+	// Reading a makes b the least recently used
+	if value, _ := c.Get("a"); value != "1" {
+		t.Errorf("Get(a) = %q", value)
+	}
+	c.Set("c", "3", 0)
+
+	if value, _ := c.Get("b"); value != "" {
+		t.Errorf("expected b to be evicted, got %q", value)
+	}
+	if value, _ := c.Get("a"); value != "1" {
+		t.Errorf("Get(a) = %q", value)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d", c.Len())
+	}
+
+	c.Set("d", "4", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if value, _ := c.Get("d"); value != "" {
+		t.Errorf("expected d to be expired, got %q", value)
+	}
+}
+
+func TestLRUZeroValue(t *testing.T) {
+	var c LRU
+	if value, _ := c.Get("a"); value != "" || c.Len() != 0 {
+		t.Errorf("expected an empty store, got %q and %d values", value, c.Len())
+	}
+	c.Set("a", "1", 0)
+	if value, _ := c.Get("a"); value != "1" || c.Len() != 1 {
+		t.Errorf("Get(a) = %q with %d values", value, c.Len())
+	}
+}
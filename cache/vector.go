@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// VectorIndex stores values by the embedding of their prompt for the semantic cache.
+// Values are only compared with values in the same partition.
+type VectorIndex interface {
+	// Nearest returns the value with the highest cosine similarity to vector, value is "" if the partition is empty
+	Nearest(partition string, vector []float32) (value string, similarity float64, err error)
+	// Add stores the value, if the duration is zero or negative the value is kept forever
+	Add(partition string, vector []float32, value string, duration time.Duration) error
+}
+
+// MemoryIndex is a VectorIndex that compares the vector with every value of the partition.
+// Create one with NewMemoryIndex, the zero value is an empty index without a limit.
+type MemoryIndex struct {
+	MaxEntries int // Per partition, the oldest value is removed when it is full. 0 means no limit
+
+	lock       sync.Mutex
+	partitions map[string][]vectorEntry
+}
+
+type vectorEntry struct {
+	vector    []float32
+	norm      float64
+	value     string
+	expiresAt time.Time // Zero if the entry does not expire
+}
+
+var _ VectorIndex = &MemoryIndex{}
+
+func NewMemoryIndex(maxEntries int) *MemoryIndex {
+	return &MemoryIndex{
+		MaxEntries: maxEntries,
+		partitions: map[string][]vectorEntry{},
+	}
+}
+
+func (idx *MemoryIndex) Nearest(partition string, vector []float32) (string, float64, error) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	norm := vectorNorm(vector)
+	if norm == 0 {
+		return "", 0, nil
+	}
+
+	now := time.Now()
+	entries := idx.partitions[partition][:0]
+	var value string
+	bestSimilarity := math.Inf(-1)
+	for _, entry := range idx.partitions[partition] {
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			continue
+		}
+		entries = append(entries, entry)
+
+		if len(entry.vector) != len(vector) || entry.norm == 0 {
+			continue
+		}
+		var dot float64
+		for i := range vector {
+			dot += float64(vector[i]) * float64(entry.vector[i])
+		}
+		if similarity := dot / (norm * entry.norm); similarity > bestSimilarity {
+			bestSimilarity = similarity
+			value = entry.value
+		}
+	}
+	if len(entries) == 0 {
+		delete(idx.partitions, partition)
+	} else {
+		idx.partitions[partition] = entries
+	}
+
+	if value == "" {
+		return "", 0, nil
+	}
+	return value, bestSimilarity, nil
+}
+
+func (idx *MemoryIndex) Add(partition string, vector []float32, value string, duration time.Duration) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	entry := vectorEntry{
+		vector: vector,
+		norm:   vectorNorm(vector),
+		value:  value,
+	}
+	if duration > 0 {
+		entry.expiresAt = time.Now().Add(duration)
+	}
+
+	if idx.partitions == nil {
+		idx.partitions = map[string][]vectorEntry{}
+	}
+	entries := append(idx.partitions[partition], entry)
+	if idx.MaxEntries > 0 && len(entries) > idx.MaxEntries {
+		entries = entries[len(entries)-idx.MaxEntries:]
+	}
+	idx.partitions[partition] = entries
+	return nil
+}
+
+func vectorNorm(vector []float32) float64 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,37 @@
+package cache
+
+import "testing"
+
+func TestMemoryIndex(t *testing.T) {
+	idx := NewMemoryIndex(2)
+
+	if value, _, _ := idx.Nearest("a", []float32{1, 0}); value != "" {
+		t.Errorf("expected no value in an empty index, got %q", value)
+	}
+
+	idx.Add("a", []float32{1, 0}, "east", 0)
+	idx.Add("a", []float32{0, 1}, "north", 0)
+	idx.Add("b", []float32{1, 1}, "other partition", 0)
+
+	value, similarity, _ := idx.Nearest("a", []float32{0.9, 0.1})
+	if value != "east" || similarity < 0.99 {
+		t.Errorf("Nearest = %q (%f), want east", value, similarity)
+	}
+
+	// The oldest value is removed when the partition is full
+	idx.Add("a", []float32{-1, 0}, "west", 0)
+	if value, _, _ := idx.Nearest("a", []float32{1, 0}); value == "east" {
+		t.Errorf("expected east to be removed")
+	}
+}
+
+func TestMemoryIndexZeroValue(t *testing.T) {
+	var idx MemoryIndex
+	if value, _, _ := idx.Nearest("a", []float32{1, 0}); value != "" {
+		t.Errorf("expected no value in an empty index, got %q", value)
+	}
+	idx.Add("a", []float32{1, 0}, "east", 0)
+	if value, _, _ := idx.Nearest("a", []float32{1, 0}); value != "east" {
+		t.Errorf("Nearest = %q, want east", value)
+	}
+}
@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+type PartType string
+
+const (
+	PartText  PartType = "text"
+	PartImage PartType = "image"
+	PartAudio PartType = "audio"
+	PartFile  PartType = "file" // Documents like a PDF
+)
+
+// Part is a piece of multimodal message content. Besides text parts either
+// Data or URL is set, MimeType is required for Data.
+type Part struct {
+	Type     PartType `json:"type"`
+	Text     string   `json:"text,omitempty"`
+	Data     []byte   `json:"data,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	MimeType string   `json:"mime_type,omitempty"`
+	Name     string   `json:"name,omitempty"` // The file name, used by some providers for documents
+}
+
+// DataURL returns the data of the part as a base64 data url
+func (p Part) DataURL() string {
+	return "data:" + p.MimeType + ";base64," + base64.StdEncoding.EncodeToString(p.Data)
+}
+
+func TextPart(text string) Part {
+	return Part{Type: PartText, Text: text}
+}
+
+func ImagePart(data []byte, mimeType string) Part {
+	return Part{Type: PartImage, Data: data, MimeType: mimeType}
+}
+
+func ImageURLPart(url string) Part {
+	return Part{Type: PartImage, URL: url}
+}
+
+func AudioPart(data []byte, mimeType string) Part {
+	return Part{Type: PartAudio, Data: data, MimeType: mimeType}
+}
+
+func FilePart(name string, data []byte, mimeType string) Part {
+	return Part{Type: PartFile, Name: name, Data: data, MimeType: mimeType}
+}
+
+func FileURLPart(url string, mimeType string) Part {
+	return Part{Type: PartFile, URL: url, MimeType: mimeType}
+}
+
+// UserWithParts creates a user message with text followed by other content like images
+func UserWithParts(text string, parts ...Part) Message {
+	return Message{Role: "user", Content: text, Parts: parts}
+}
+
+// UserWithImage creates a user message with text and an image, mimeType is for example "image/png"
+func UserWithImage(text string, data []byte, mimeType string) Message {
+	return UserWithParts(text, ImagePart(data, mimeType))
+}
+
+// UserWithAudio creates a user message with text and an audio fragment, mimeType is for example "audio/wav"
+func UserWithAudio(text string, data []byte, mimeType string) Message {
+	return UserWithParts(text, AudioPart(data, mimeType))
+}
+
+// UserWithFile creates a user message with text and a document, mimeType is for example "application/pdf"
+func UserWithFile(text string, name string, data []byte, mimeType string) Message {
+	return UserWithParts(text, FilePart(name, data, mimeType))
+}
+
+// validateParts checks every part of the messages can be send to the provider
+func validateParts(messages []Message, provider Provider) error {
+	for idx, message := range messages {
+		if len(message.Parts) == 0 {
+			continue
+		}
+		if message.Role != "user" {
+			return fmt.Errorf("message #%d: only user messages can contain parts", idx+1)
+		}
+
+		for _, part := range message.Parts {
+			switch part.Type {
+			case PartText:
+				continue
+			case PartImage, PartAudio, PartFile:
+			default:
+				return fmt.Errorf("message #%d: unknown part type %q", idx+1, part.Type)
+			}
+
+			if len(part.Data) == 0 && part.URL == "" {
+				return fmt.Errorf("message #%d: %s part requires Data or a URL", idx+1, part.Type)
+			}
+			if len(part.Data) > 0 && part.MimeType == "" {
+				return fmt.Errorf("message #%d: %s part with Data requires a MimeType", idx+1, part.Type)
+			}
+			if !provider.SupportsPart(part.Type) {
+				return fmt.Errorf("provider %T does not support %s parts", provider, part.Type)
+			}
+		}
+	}
+	return nil
+}
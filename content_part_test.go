@@ -0,0 +1,32 @@
+package llm_test
+
+import (
+	"strings"
+	"testing"
+
+	llm "github.com/Back-to-code/go-llm"
+	"github.com/Back-to-code/go-llm/inception"
+	"github.com/Back-to-code/go-llm/ollama"
+)
+
+// Test parts are rejected before a request is made when the provider can not handle them.
+func TestPartsRejectedByProvider(t *testing.T) {
+	invoice := []byte("%PDF-1.7")
+
+	model := &llm.Model{Name: "mercury-2", Provider: &inception.Provider{}}
+	_, err := model.Prompt([]llm.Message{llm.UserWithImage("what is this?", []byte{0x89, 'P', 'N', 'G'}, "image/png")}, llm.Options{Retry: llm.NoRetry})
+	if err == nil || !strings.Contains(err.Error(), "does not support image parts") {
+		t.Errorf("expected image parts to be rejected, got %v", err)
+	}
+
+	model = &llm.Model{Name: "gemma3", Provider: &ollama.Provider{}}
+	_, err = model.Prompt([]llm.Message{llm.UserWithFile("triage this invoice", "invoice.pdf", invoice, "application/pdf")}, llm.Options{Retry: llm.NoRetry})
+	if err == nil || !strings.Contains(err.Error(), "does not support file parts") {
+		t.Errorf("expected file parts to be rejected, got %v", err)
+	}
+
+	_, err = model.Prompt([]llm.Message{llm.UserWithParts("missing data", llm.Part{Type: llm.PartImage})}, llm.Options{Retry: llm.NoRetry})
+	if err == nil || !strings.Contains(err.Error(), "requires Data or a URL") {
+		t.Errorf("expected an empty image part to be rejected, got %v", err)
+	}
+}
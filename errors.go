@@ -0,0 +1,211 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrRateLimited           = errors.New("rate limited")
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+	ErrAuth                  = errors.New("authentication failed")
+	ErrContentFiltered       = errors.New("content filtered")
+	ErrServer                = errors.New("server error")
+)
+
+// APIError is returned when a provider API responds with an error, use errors.Is
+// with one of the Err* values to check what kind of error it is.
+type APIError struct {
+	Provider   string
+	StatusCode int    // 0 if the error was send inside a stream
+	Code       string // The error code of the provider, like "rate_limit_exceeded" or "RESOURCE_EXHAUSTED"
+	Message    string
+	RequestId  string
+	RetryAfter time.Duration // How long the provider asked to wait before retrying, 0 if unknown
+	Body       string        // The raw error response
+}
+
+func (e *APIError) Error() string {
+	msg := e.Provider + " API error"
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (status %d)", e.StatusCode)
+	}
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		return msg + ": " + e.Message
+	}
+	if e.Body != "" {
+		return msg + ": " + e.Body
+	}
+	return msg
+}
+
+func (e *APIError) Is(target error) bool {
+	kind := e.Kind()
+	return kind != nil && kind == target
+}
+
+// Kind returns the Err* value this error matches, nil if it is not classified
+func (e *APIError) Kind() error {
+	return classifyAPIError(e)
+}
+
+// Retryable reports if sending the same request again might succeed
+func (e *APIError) Retryable() bool {
+	switch e.Kind() {
+	case ErrRateLimited, ErrServer:
+		return true
+	}
+	return e.StatusCode == http.StatusRequestTimeout
+}
+
+// NewAPIError creates an error from an error response of a provider, resp may be nil for errors send inside a stream.
+// The body is parsed as one of the common error formats, like {"error":{"message":"..","code":".."}}.
+func NewAPIError(provider string, resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		Provider: provider,
+		Body:     strings.TrimSpace(string(body)),
+	}
+	if resp != nil {
+		e.StatusCode = resp.StatusCode
+		e.RequestId = resp.Header.Get("X-Request-Id")
+		if e.RequestId == "" {
+			e.RequestId = resp.Header.Get("Request-Id")
+		}
+		e.RetryAfter = parseRetryAfter(resp.Header)
+	}
+
+	e.parseBody(body)
+	return e
+}
+
+type apiErrorBody struct {
+	Message string          `json:"message"`
+	Code    json.RawMessage `json:"code"`   // A string for most providers, the http status for Gemini
+	Type    string          `json:"type"`   // Anthropic and OpenAI
+	Status  string          `json:"status"` // Gemini
+	Details []struct {
+		Type       string `json:"@type"`
+		RetryDelay string `json:"retryDelay"`
+	} `json:"details"`
+}
+
+func (e *APIError) parseBody(body []byte) {
+	wrapper := struct {
+		Error json.RawMessage `json:"error"`
+	}{}
+	if json.Unmarshal(body, &wrapper) != nil {
+		return
+	}
+
+	errorBody := wrapper.Error
+	if len(errorBody) == 0 {
+		// Some streams send the error object without wrapping it
+		errorBody = body
+	}
+
+	var message string
+	if json.Unmarshal(errorBody, &message) == nil {
+		// Ollama only has a message
+		e.Message = message
+		return
+	}
+
+	var parsed apiErrorBody
+	if json.Unmarshal(errorBody, &parsed) != nil {
+		return
+	}
+
+	e.Message = parsed.Message
+	var code string
+	var statusCode int
+	if json.Unmarshal(parsed.Code, &code) == nil && code != "" {
+		e.Code = code
+	} else if json.Unmarshal(parsed.Code, &statusCode) == nil && e.StatusCode == 0 {
+		e.StatusCode = statusCode
+	}
+	if e.Code == "" {
+		e.Code = parsed.Status
+	}
+	if e.Code == "" {
+		e.Code = parsed.Type
+	}
+
+	for _, detail := range parsed.Details {
+		if e.RetryAfter == 0 && strings.HasSuffix(detail.Type, "RetryInfo") {
+			e.RetryAfter, _ = time.ParseDuration(detail.RetryDelay)
+		}
+	}
+}
+
+// parseRetryAfter reads the retry-after-ms and Retry-After headers, Retry-After can be in seconds or a http date
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.Atoi(header.Get("Retry-After-Ms")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+func classifyAPIError(e *APIError) error {
+	code := strings.ToLower(e.Code)
+	message := strings.ToLower(e.Message)
+
+	switch {
+	case code == "context_length_exceeded",
+		strings.Contains(message, "context length"),
+		strings.Contains(message, "context window"),
+		strings.Contains(message, "maximum context"),
+		strings.Contains(message, "prompt is too long"),
+		strings.Contains(message, "input token count") && strings.Contains(message, "exceeds"):
+		return ErrContextLengthExceeded
+	case code == "content_filter",
+		code == "content_policy_violation",
+		strings.Contains(message, "content management policy"),
+		strings.Contains(message, "content filter"),
+		code == "safety",
+		code == "prohibited_content",
+		code == "blocklist",
+		code == "spii",
+		code == "image_safety":
+		return ErrContentFiltered
+	case e.StatusCode == http.StatusTooManyRequests,
+		code == "rate_limit_exceeded",
+		code == "rate_limit_error",
+		code == "resource_exhausted":
+		return ErrRateLimited
+	case e.StatusCode == http.StatusUnauthorized,
+		e.StatusCode == http.StatusForbidden,
+		code == "invalid_api_key",
+		code == "authentication_error",
+		code == "permission_error",
+		code == "unauthenticated",
+		code == "permission_denied":
+		return ErrAuth
+	case e.StatusCode >= 500,
+		code == "overloaded_error",
+		code == "api_error",
+		code == "server_error",
+		code == "unavailable",
+		code == "internal":
+		return ErrServer
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package llm_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		want       error
+		code       string
+		retryAfter time.Duration
+	}{
+		{
+			name:       "openai rate limit",
+			status:     429,
+			header:     http.Header{"Retry-After": {"7"}, "X-Request-Id": {"req_1"}},
+			body:       `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`,
+			want:       llm.ErrRateLimited,
+			code:       "rate_limit_exceeded",
+			retryAfter: 7 * time.Second,
+		},
+		{
+			name:   "openai context length",
+			status: 400,
+			body:   `{"error":{"message":"This model's maximum context length is 128000 tokens.","type":"invalid_request_error","code":"context_length_exceeded"}}`,
+			want:   llm.ErrContextLengthExceeded,
+			code:   "context_length_exceeded",
+		},
+		{
+			name:       "gemini quota with retry info",
+			status:     429,
+			body:       `{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED","details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"21s"}]}}`,
+			want:       llm.ErrRateLimited,
+			code:       "RESOURCE_EXHAUSTED",
+			retryAfter: 21 * time.Second,
+		},
+		{
+			name:   "anthropic auth",
+			status: 401,
+			body:   `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`,
+			want:   llm.ErrAuth,
+			code:   "authentication_error",
+		},
+		{
+			name:   "azure content filter",
+			status: 400,
+			body:   `{"error":{"message":"The response was filtered","code":"content_filter"}}`,
+			want:   llm.ErrContentFiltered,
+			code:   "content_filter",
+		},
+		{
+			name:   "server error without body",
+			status: 502,
+			body:   `<html>Bad Gateway</html>`,
+			want:   llm.ErrServer,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := test.header
+			if header == nil {
+				header = http.Header{}
+			}
+			apiErr := llm.NewAPIError("test", &http.Response{StatusCode: test.status, Header: header}, []byte(test.body))
+
+			// Wrapping must not hide the kind of error
+			err := fmt.Errorf("prompt: %w", apiErr)
+			if !errors.Is(err, test.want) {
+				t.Errorf("errors.Is(%v, %v) = false", err, test.want)
+			}
+			if apiErr.Code != test.code {
+				t.Errorf("Code = %q, want %q", apiErr.Code, test.code)
+			}
+			if apiErr.RetryAfter != test.retryAfter {
+				t.Errorf("RetryAfter = %v, want %v", apiErr.RetryAfter, test.retryAfter)
+			}
+			if apiErr.Retryable() != (test.want == llm.ErrRateLimited || test.want == llm.ErrServer) {
+				t.Errorf("Retryable() = %v", apiErr.Retryable())
+			}
+		})
+	}
+
+	apiErr := llm.NewAPIError("test", &http.Response{StatusCode: 429, Header: http.Header{"X-Request-Id": {"req_1"}}}, nil)
+	if apiErr.RequestId != "req_1" {
+		t.Errorf("RequestId = %q", apiErr.RequestId)
+	}
+}
@@ -8,6 +8,9 @@ import (
 
 type FallbackModel struct {
 	Models []Prompter
+	// StreamFallback also switches to the next model when a stream fails before producing any output,
+	// by default only streams that can not be started are retried with the next model
+	StreamFallback bool
 }
 
 func NewFallbackModel(models ...Prompter) *FallbackModel {
@@ -33,13 +36,6 @@ func (f *FallbackModel) Prompt(messages []Message, options Options) (Response, e
 		return Response{}, errors.New("FallbackModel has no models")
 	}
 
-	for _, msg := range messages {
-		if msg.Role == "tool" {
-			// Different providers handle tools differently so we can't allow tool messages when using fallback models
-			return Response{}, errors.New("FallbackModel does not support tool messages")
-		}
-	}
-
 	var lastErr error
 	for _, model := range f.Models {
 		if options.Ctx != nil && options.Ctx.Err() != nil {
@@ -59,15 +55,16 @@ func (f *FallbackModel) PromptSingle(message string, options Options) (Response,
 }
 
 func (f *FallbackModel) Stream(messages []Message, options Options) (chan string, error) {
-	if len(f.Models) == 0 {
-		return nil, errors.New("FallbackModel has no models")
+	events, err := f.StreamEvents(messages, options)
+	if err != nil {
+		return nil, err
 	}
+	return TextStream(events), nil
+}
 
-	for _, msg := range messages {
-		if msg.Role == "tool" {
-			// Different providers handle tools differently so we can't allow tool messages when using fallback models
-			return nil, errors.New("FallbackModel does not support tool messages")
-		}
+func (f *FallbackModel) StreamEvents(messages []Message, options Options) (chan StreamEvent, error) {
+	if len(f.Models) == 0 {
+		return nil, errors.New("FallbackModel has no models")
 	}
 
 	var lastErr error
@@ -75,7 +72,10 @@ func (f *FallbackModel) Stream(messages []Message, options Options) (chan string
 		if options.Ctx != nil && options.Ctx.Err() != nil {
 			return nil, options.Ctx.Err()
 		}
-		ch, err := model.Stream(messages, options)
+		ch, err := model.StreamEvents(messages, options)
+		if err == nil && f.StreamFallback {
+			ch, err = awaitOutput(ch)
+		}
 		if err == nil {
 			return ch, nil
 		}
@@ -18,7 +18,7 @@ var (
 
 type stubPrompter struct {
 	promptFn func(messages []llm.Message, options llm.Options) (llm.Response, error)
-	streamFn func(messages []llm.Message, options llm.Options) (chan string, error)
+	streamFn func(messages []llm.Message, options llm.Options) (chan llm.StreamEvent, error)
 	calls    atomic.Int32
 }
 
@@ -32,6 +32,14 @@ func (s *stubPrompter) PromptSingle(message string, options llm.Options) (llm.Re
 }
 
 func (s *stubPrompter) Stream(messages []llm.Message, options llm.Options) (chan string, error) {
+	events, err := s.StreamEvents(messages, options)
+	if err != nil {
+		return nil, err
+	}
+	return llm.TextStream(events), nil
+}
+
+func (s *stubPrompter) StreamEvents(messages []llm.Message, options llm.Options) (chan llm.StreamEvent, error) {
 	s.calls.Add(1)
 	return s.streamFn(messages, options)
 }
@@ -187,7 +195,7 @@ func TestFallbackModel_AcceptsRealModel(t *testing.T) {
 
 	fb := llm.NewFallbackModel(realModel)
 
-	resp, err := fb.Prompt([]llm.Message{llm.User("hi")}, llm.Options{NoRetry: true})
+	resp, err := fb.Prompt([]llm.Message{llm.User("hi")}, llm.Options{Retry: llm.NoRetry})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -198,7 +206,9 @@ func TestFallbackModel_AcceptsRealModel(t *testing.T) {
 
 type stubProvider struct {
 	promptFn    func(model string, messages []llm.Message, options llm.Options) (llm.Response, error)
+	streamFn    func(model string, messages []llm.Message, options llm.Options) (chan llm.StreamEvent, error)
 	promptCalls atomic.Int32
+	streamCalls atomic.Int32
 }
 
 func (s *stubProvider) Prompt(model string, messages []llm.Message, options llm.Options) (llm.Response, error) {
@@ -206,13 +216,19 @@ func (s *stubProvider) Prompt(model string, messages []llm.Message, options llm.
 	return s.promptFn(model, messages, options)
 }
 
-func (s *stubProvider) Stream(string, []llm.Message, llm.Options) (chan string, error) {
-	return nil, errors.New("not implemented")
+func (s *stubProvider) StreamEvents(model string, messages []llm.Message, options llm.Options) (chan llm.StreamEvent, error) {
+	s.streamCalls.Add(1)
+	if s.streamFn == nil {
+		return nil, errors.New("not implemented")
+	}
+	return s.streamFn(model, messages, options)
 }
 
 func (s *stubProvider) SupportsStructuredOutput() bool { return true }
+func (s *stubProvider) SupportsJsonSchema() bool       { return true }
 func (s *stubProvider) SupportsStreaming() bool        { return true }
 func (s *stubProvider) SupportsTools() bool            { return true }
+func (s *stubProvider) SupportsPart(llm.PartType) bool { return true }
 
 func okPromptProvider(value string) func(string, []llm.Message, llm.Options) (llm.Response, error) {
 	return func(_ string, messages []llm.Message, _ llm.Options) (llm.Response, error) {
@@ -222,3 +238,49 @@ func okPromptProvider(value string) func(string, []llm.Message, llm.Options) (ll
 		}, nil
 	}
 }
+
+func TestFallbackModel_AcceptsToolMessages(t *testing.T) {
+	m := llm.NewFallbackModel(errPrompter(errors.New("down")), okPrompter("done"))
+	conversation := []llm.Message{
+		llm.User("weather?"),
+		{Role: "assistant", ToolCalls: []llm.ToolCall{{Id: "call_1", Name: "get_weather", Arguments: `{}`}}},
+		{Role: "tool", ToolCallId: "call_1", Content: `"sunny"`},
+	}
+
+	resp, err := m.Prompt(conversation, llm.Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Value != "done" {
+		t.Fatalf("expected the second model to answer, got %q", resp.Value)
+	}
+}
+
+func TestFallbackModel_StreamFallback(t *testing.T) {
+	failing := &stubPrompter{streamFn: func([]llm.Message, llm.Options) (chan llm.StreamEvent, error) {
+		return eventStream(llm.StreamEvent{Kind: llm.StreamError, Err: errors.New("overloaded")}), nil
+	}}
+	ok := &stubPrompter{streamFn: func([]llm.Message, llm.Options) (chan llm.StreamEvent, error) {
+		return eventStream(llm.StreamEvent{Kind: llm.StreamText, Text: "from-second"}), nil
+	}}
+
+	// By default a stream that started is not switched
+	events, err := llm.NewFallbackModel(failing, ok).StreamEvents([]llm.Message{llm.User("hi")}, llm.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err = llm.CollectStream(nil, events); err == nil || ok.calls.Load() != 0 {
+		t.Errorf("expected the error of the first model, got %v", err)
+	}
+
+	fb := llm.NewFallbackModel(failing, ok)
+	fb.StreamFallback = true
+	events, err = fb.StreamEvents([]llm.Message{llm.User("hi")}, llm.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	resp, err := llm.CollectStream(nil, events)
+	if err != nil || resp.Value != "from-second" {
+		t.Errorf("expected the second model to answer, got %q and %v", resp.Value, err)
+	}
+}
@@ -2,4 +2,4 @@ module github.com/Back-to-code/go-llm
 
 go 1.25.1
 
-require github.com/joho/godotenv v1.5.1 // indirect
+require github.com/joho/godotenv v1.5.1
@@ -1,19 +1,26 @@
 package googleaistudio
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/Back-to-code/go-llm"
 	apikey "github.com/Back-to-code/go-llm/apikeys"
 )
 
+// BaseURL is the Google AI Studio API base URL. Exported for test overrides.
+var BaseURL = "https://generativelanguage.googleapis.com"
+
 type Provider struct{}
 
+var _ llm.Provider = &Provider{}
+
 type ResponseFormat struct {
 	Type string `json:"type"`
 }
@@ -23,12 +30,39 @@ type Response struct {
 		Content struct {
 			Parts []Part `json:"parts"`
 		} `json:"content"`
+		FinishReason string `json:"finishReason"`
 	} `json:"candidates"`
 	UsageMetadata struct {
 		PromptTokenCount        int `json:"promptTokenCount"`
 		CandidatesTokenCount    int `json:"candidatesTokenCount"`
 		CachedContentTokenCount int `json:"cachedContentTokenCount"`
 	} `json:"usageMetadata"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+}
+
+func (r Response) usage() llm.TokenUsage {
+	return llm.TokenUsage{
+		InputTokens:       r.UsageMetadata.PromptTokenCount,
+		OutputTokens:      r.UsageMetadata.CandidatesTokenCount,
+		CachedInputTokens: r.UsageMetadata.CachedContentTokenCount,
+	}
+}
+
+// blockedError returns an error if the prompt or the answer was blocked by the safety filters
+func (r Response) blockedError() error {
+	reason := r.PromptFeedback.BlockReason
+	if reason == "" && len(r.Candidates) > 0 {
+		switch finishReason := r.Candidates[len(r.Candidates)-1].FinishReason; finishReason {
+		case "SAFETY", "PROHIBITED_CONTENT", "BLOCKLIST", "SPII", "IMAGE_SAFETY":
+			reason = finishReason
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+	return &llm.APIError{Provider: "googleaistudio", Code: reason, Message: "content filtered"}
 }
 
 type Content struct {
@@ -38,11 +72,24 @@ type Content struct {
 
 type Part struct {
 	Text             string            `json:"text,omitempty"`
+	Thought          bool              `json:"thought,omitempty"`
 	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
 	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+	InlineData       *Blob             `json:"inlineData,omitempty"`
+	FileData         *FileData         `json:"fileData,omitempty"`
 	ThoughtSignature string            `json:"thoughtSignature,omitempty"`
 }
 
+type Blob struct {
+	MimeType string `json:"mimeType"`
+	Data     []byte `json:"data"` // Base64 encoded by encoding/json
+}
+
+type FileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileUri  string `json:"fileUri"`
+}
+
 type SystemInstruction struct {
 	Parts []Part `json:"parts,omitempty"`
 }
@@ -50,123 +97,103 @@ type SystemInstruction struct {
 type GenerationConfig struct {
 	MaxOutputTokens  int             `json:"maxOutputTokens,omitempty"`
 	ResponseMimeType string          `json:"response_mime_type,omitempty"`
+	ResponseSchema   json.RawMessage `json:"responseSchema,omitempty"`
 	ThinkingConfig   *ThinkingConfig `json:"thinkingConfig,omitempty"`
+	Temperature      *float64        `json:"temperature,omitempty"`
+	TopP             *float64        `json:"topP,omitempty"`
+	Seed             *int            `json:"seed,omitempty"`
+	StopSequences    []string        `json:"stopSequences,omitempty"`
+	PresencePenalty  *float64        `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64        `json:"frequencyPenalty,omitempty"`
 }
 
 func (*Provider) SupportsStructuredOutput() bool {
 	return true
 }
 
+func (*Provider) SupportsJsonSchema() bool {
+	return true
+}
+
 func (*Provider) SupportsStreaming() bool {
-	return false
+	return true
 }
 
 func (*Provider) SupportsTools() bool {
 	return true
 }
 
+func (*Provider) SupportsPart(partType llm.PartType) bool {
+	return true
+}
+
 func (p *Provider) Prompt(model string, messages []llm.Message, opts llm.Options) (llm.Response, error) {
+	return llm.ToolLoop{
+		Options: opts,
+		Round: func(messages []llm.Message, opts llm.Options) (llm.RoundResult, error) {
+			return p.promptRound(model, messages, opts)
+		},
+	}.Run(messages)
+}
+
+// promptRound sends a single request, the function calls in the answer are resolved by the llm.ToolLoop
+func (p *Provider) promptRound(model string, messages []llm.Message, opts llm.Options) (llm.RoundResult, error) {
 	chatResponse, err := p.doRequest(model, messages, opts)
 	if err != nil {
-		return llm.Response{}, err
+		return llm.RoundResult{}, err
+	}
+
+	if err := chatResponse.blockedError(); err != nil {
+		return llm.RoundResult{}, err
 	}
 
 	candidates := chatResponse.Candidates
 	if len(candidates) == 0 {
-		return llm.Response{}, errors.New("chat did not return any results")
+		return llm.RoundResult{}, errors.New("chat did not return any results")
 	}
 
-	currentUsage := llm.TokenUsage{
-		InputTokens:       chatResponse.UsageMetadata.PromptTokenCount,
-		OutputTokens:      chatResponse.UsageMetadata.CandidatesTokenCount,
-		CachedInputTokens: chatResponse.UsageMetadata.CachedContentTokenCount,
+	candidate := candidates[len(candidates)-1]
+	if len(candidate.Content.Parts) == 0 {
+		return llm.RoundResult{}, errors.New("chat did not return any result parts")
 	}
 
-	parts := candidates[len(candidates)-1].Content.Parts
-	if len(parts) == 0 {
-		return llm.Response{}, errors.New("chat did not return any result parts")
+	round := llm.RoundResult{
+		Message:      llm.Message{Role: "assistant"},
+		Usage:        chatResponse.usage(),
+		StopReason:   toStopReason(candidate.FinishReason),
+		FinishReason: candidate.FinishReason,
 	}
-
-	// Check if the model is requesting function calls
-	var functionParts []Part
-	for _, part := range parts {
-		if part.FunctionCall != nil {
-			functionParts = append(functionParts, part)
-		}
+	for _, part := range candidate.Content.Parts {
+		appendPart(&round, part)
 	}
-
-	if len(functionParts) > 0 {
-		// Store the function calls on the assistant message so they can be
-		// reconstructed into functionCall parts on the next round-trip.
-		toolCallsJson, err := json.Marshal(functionParts)
-		if err != nil {
-			return llm.Response{}, fmt.Errorf("marshaling function calls: %w", err)
-		}
-		messages = append(messages, llm.Message{
-			Role:      "assistant",
-			ToolCalls: toolCallsJson,
-		})
-
-		// Resolve each function call
-		responses, err := resolveToolCalls(functionParts, opts.Tools)
-		if err != nil {
-			return llm.Response{}, fmt.Errorf("resolving tool calls: %w", err)
-		}
-
-		// Append each result as a "tool" message. We use ToolCallId to carry
-		// the function name (Gemini has no call IDs — it matches by name).
-		for _, resp := range responses {
-			responseJson, err := json.Marshal(resp.Response)
-			if err != nil {
-				responseJson = []byte(`{"error":"failed to marshal response"}`)
-			}
-			messages = append(messages, llm.Message{
-				Role:       "tool",
-				Content:    string(responseJson),
-				ToolCallId: resp.Name,
-			})
-		}
-
-		// Recurse to continue the conversation after tool calls.
-		// Accumulate token usage from this round with the inner rounds.
-		innerResp, err := p.Prompt(model, messages, opts)
-		if err != nil {
-			return llm.Response{}, err
-		}
-		innerResp.Usage.InputTokens += currentUsage.InputTokens
-		innerResp.Usage.OutputTokens += currentUsage.OutputTokens
-		innerResp.Usage.CachedInputTokens += currentUsage.CachedInputTokens
-		return innerResp, nil
+	if len(round.Message.ToolCalls) == 0 && round.Message.Content == "" {
+		return llm.RoundResult{}, errors.New("chat did not return any text content")
 	}
+	return round, nil
+}
 
-	// No function calls — return the text response
-	var text string
-	for _, part := range parts {
-		if part.Text != "" {
-			text += part.Text
-		}
+// doRequest builds and sends a single generateContent request, returning the
+// parsed response. This is separated from Prompt so the tool-call loop can
+// call it repeatedly without duplicating HTTP logic.
+func (p *Provider) doRequest(model string, messages []llm.Message, opts llm.Options) (*Response, error) {
+	resp, err := p.sendRequest(model, ":generateContent", messages, opts)
+	if err != nil {
+		return nil, err
 	}
-	if text == "" {
-		return llm.Response{}, errors.New("chat did not return any text content")
+	defer resp.Body.Close()
+
+	chatResponse := Response{}
+	err = json.NewDecoder(resp.Body).Decode(&chatResponse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode body: %s", err.Error())
 	}
 
-	// Append the final assistant message to the conversation.
-	messages = append(messages, llm.Message{
-		Role:    "assistant",
-		Content: text,
-	})
-
-	return llm.Response{
-		Value:        text,
-		Conversation: messages,
-		Usage:        currentUsage,
-	}, nil
+	return &chatResponse, nil
 }
 
-// doRequest builds and sends a single generateContent request, returning the
-// parsed response. This is separated from Prompt so the tool-call loop can
-// call it repeatedly without duplicating HTTP logic.
-func (*Provider) doRequest(model string, messages []llm.Message, opts llm.Options) (*Response, error) {
+// sendRequest builds the request payload and sends it to the given model
+// method, the caller is responsible for closing the body of the response.
+func (*Provider) sendRequest(model string, method string, messages []llm.Message, opts llm.Options) (*http.Response, error) {
 	apiKey, err := apikey.GoogleAiStudio()
 	if err != nil {
 		return nil, err
@@ -185,27 +212,51 @@ func (*Provider) doRequest(model string, messages []llm.Message, opts llm.Option
 	}
 
 	var responseMimeType string
-	if opts.ResponseFormat == llm.ResponseFormatJsonObject {
+	var responseSchema json.RawMessage
+	switch opts.ResponseFormat {
+	case llm.ResponseFormatJsonObject:
+		responseMimeType = "application/json"
+	case llm.ResponseFormatJsonSchema:
 		responseMimeType = "application/json"
+		responseSchema, err = convertResponseSchema(opts.JsonSchema.Schema)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Build tools and tool_config if tools are provided
-	geminiTools := convertTools(opts.Tools)
+	geminiTools, err := convertTools(opts.Tools)
+	if err != nil {
+		return nil, err
+	}
+	var toolConfig *ToolConfig
+	if len(geminiTools) > 0 {
+		toolConfig = convertToolChoice(opts.ToolChoice)
+	}
 
 	requestPayload := struct {
 		SystemInstruction *SystemInstruction `json:"system_instruction,omitempty"`
 		Contents          []Content          `json:"contents"`
 		GenerationConfig  GenerationConfig   `json:"generationConfig"`
 		Tools             []GeminiTool       `json:"tools,omitempty"`
+		ToolConfig        *ToolConfig        `json:"toolConfig,omitempty"`
 	}{
 		SystemInstruction: systemInstruction,
 		Contents:          contents,
 		GenerationConfig: GenerationConfig{
 			MaxOutputTokens:  opts.MaxTokens,
 			ResponseMimeType: responseMimeType,
+			ResponseSchema:   responseSchema,
 			ThinkingConfig:   getThinkingConfig(model, opts.Thinking),
+			Temperature:      opts.Temperature,
+			TopP:             opts.TopP,
+			Seed:             opts.Seed,
+			StopSequences:    opts.StopSequences,
+			PresencePenalty:  opts.PresencePenalty,
+			FrequencyPenalty: opts.FrequencyPenalty,
 		},
-		Tools: geminiTools,
+		Tools:      geminiTools,
+		ToolConfig: toolConfig,
 	}
 
 	requestPayloadBytes, err := json.Marshal(requestPayload)
@@ -214,13 +265,18 @@ func (*Provider) doRequest(model string, messages []llm.Message, opts llm.Option
 	}
 	requestBody := bytes.NewReader(requestPayloadBytes)
 
+	url := BaseURL + "/v1beta/models/" + model + method
+	if strings.Contains(method, "?") {
+		url += "&key=" + apiKey
+	} else {
+		url += "?key=" + apiKey
+	}
+
 	var req *http.Request
-	url := "https://generativelanguage.googleapis.com/v1beta/models/" + model + ":generateContent?key=" + apiKey
-	method := "POST"
 	if opts.Ctx == nil {
-		req, err = http.NewRequest(method, url, requestBody)
+		req, err = http.NewRequest("POST", url, requestBody)
 	} else {
-		req, err = http.NewRequestWithContext(opts.Ctx, method, url, requestBody)
+		req, err = http.NewRequestWithContext(opts.Ctx, "POST", url, requestBody)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %s", err.Error())
@@ -231,28 +287,113 @@ func (*Provider) doRequest(model string, messages []llm.Message, opts llm.Option
 	client := http.Client{Timeout: opts.Timeout}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("sending request: %s", err.Error())
+		return nil, fmt.Errorf("sending request: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		respBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("reading response body: %s", err.Error())
-		}
-		return nil, errors.New(string(respBody))
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, llm.NewAPIError("googleaistudio", resp, respBody)
 	}
 
-	chatResponse := Response{}
-	err = json.NewDecoder(resp.Body).Decode(&chatResponse)
+	return resp, nil
+}
+
+func (p *Provider) StreamEvents(model string, messages []llm.Message, opts llm.Options) (chan llm.StreamEvent, error) {
+	resp, err := p.sendRequest(model, ":streamGenerateContent?alt=sse", messages, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode body: %s", err.Error())
+		return nil, err
 	}
 
-	return &chatResponse, nil
+	open := func(messages []llm.Message, opts llm.Options) (io.ReadCloser, error) {
+		resp, err := p.sendRequest(model, ":streamGenerateContent?alt=sse", messages, opts)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+	return llm.StreamToolLoop(resp.Body, messages, opts, open, readStream), nil
 }
 
-func (*Provider) Stream(model string, messages []llm.Message, opts llm.Options) (chan string, error) {
-	// FIXME
-	return nil, errors.New("google ai studio provider does currently not support streaming")
+// readStream parses the server sent events of streamGenerateContent, forwards
+// them as events until the stream ends and returns the answer as a round of the tool loop
+func readStream(body io.Reader, events chan llm.StreamEvent) (llm.RoundResult, error) {
+	round := llm.RoundResult{Message: llm.Message{Role: "assistant"}}
+
+	// Every chunk contains the usage up until that point, only the last one is reported
+	var usage *llm.TokenUsage
+	defer func() {
+		if usage != nil {
+			events <- llm.StreamEvent{Kind: llm.StreamUsage, Usage: *usage}
+		}
+	}()
+
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				if usage != nil {
+					round.Usage = *usage
+				}
+				return round, nil
+			}
+			return llm.RoundResult{}, fmt.Errorf("reading stream: %w", err)
+		}
+
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !ok {
+			continue
+		}
+
+		chunk := struct {
+			Response
+			Error json.RawMessage `json:"error"`
+		}{}
+		err = json.Unmarshal([]byte(strings.TrimSpace(data)), &chunk)
+		if err != nil {
+			continue
+		}
+		if len(chunk.Error) > 0 {
+			return llm.RoundResult{}, llm.NewAPIError("googleaistudio", nil, chunk.Error)
+		}
+		if err := chunk.blockedError(); err != nil {
+			return llm.RoundResult{}, err
+		}
+
+		if chunk.UsageMetadata.PromptTokenCount > 0 || chunk.UsageMetadata.CandidatesTokenCount > 0 {
+			chunkUsage := chunk.usage()
+			usage = &chunkUsage
+		}
+		if len(chunk.Candidates) == 0 {
+			continue
+		}
+
+		candidate := chunk.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			if part.FunctionCall == nil && part.Text == "" {
+				continue
+			}
+
+			toolCall := appendPart(&round, part)
+			switch {
+			case toolCall != nil:
+				// Gemini does not stream function call arguments, they arrive in one piece
+				index := len(round.Message.ToolCalls) - 1
+				events <- llm.StreamEvent{Kind: llm.StreamToolCallStarted, ToolCall: &llm.StreamToolCall{Index: index, Id: toolCall.Id, Name: toolCall.Name}}
+				events <- llm.StreamEvent{Kind: llm.StreamToolCallArgument, ToolCall: &llm.StreamToolCall{Index: index, Id: toolCall.Id, Name: toolCall.Name, Arguments: toolCall.Arguments}}
+				events <- llm.StreamEvent{Kind: llm.StreamToolCallFinished, ToolCall: &llm.StreamToolCall{Index: index, Id: toolCall.Id, Name: toolCall.Name, Arguments: toolCall.Arguments}}
+			case part.Thought:
+				events <- llm.StreamEvent{Kind: llm.StreamReasoning, Text: part.Text}
+			default:
+				events <- llm.StreamEvent{Kind: llm.StreamText, Text: part.Text}
+			}
+		}
+
+		if candidate.FinishReason != "" {
+			round.FinishReason = candidate.FinishReason
+			round.StopReason = toStopReason(candidate.FinishReason)
+			events <- llm.StreamEvent{Kind: llm.StreamFinish, FinishReason: round.FinishReason, StopReason: round.StopReason}
+		}
+	}
 }
@@ -0,0 +1,232 @@
+package googleaistudio
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+// Test that the SSE stream of streamGenerateContent is split into text deltas
+// and that thought parts are not forwarded to the caller.
+func TestStream(t *testing.T) {
+	os.Setenv("GOOGLE_AI_STUDIO_KEY", "test-key")
+	defer os.Unsetenv("GOOGLE_AI_STUDIO_KEY")
+
+	var gotPath, gotQuery string
+	var gotBody struct {
+		SystemInstruction *SystemInstruction `json:"system_instruction"`
+		Contents          []Content          `json:"contents"`
+		GenerationConfig  GenerationConfig   `json:"generationConfig"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotQuery = r.URL.RawQuery
+		json.NewDecoder(r.Body).Decode(&gotBody)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(strings.Join([]string{
+			`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"thinking...","thought":true}]}}]}`,
+			``,
+			`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hello"}]}}]}`,
+			``,
+			`data: {"candidates":[{"content":{"role":"model","parts":[{"text":" world"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2}}`,
+			``,
+		}, "\r\n")))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	p := &Provider{}
+	messages := []llm.Message{llm.System("be nice"), llm.User("hi")}
+	events, err := p.StreamEvents("gemini-test", messages, llm.Options{Temperature: llm.Ptr(0.2), Seed: llm.Ptr(7)})
+	if err != nil {
+		t.Fatalf("Stream returned error: %v", err)
+	}
+
+	resp, err := llm.CollectStream(messages, events)
+	if err != nil {
+		t.Fatalf("stream reported error: %v", err)
+	}
+	if resp.Value != "Hello world" {
+		t.Fatalf("streamed %q, want %q", resp.Value, "Hello world")
+	}
+	if resp.Usage.InputTokens != 3 || resp.Usage.OutputTokens != 2 {
+		t.Errorf("unexpected usage %+v", resp.Usage)
+	}
+	if gotPath != "/v1beta/models/gemini-test:streamGenerateContent" {
+		t.Errorf("unexpected path %q", gotPath)
+	}
+	if gotQuery != "alt=sse&key=test-key" {
+		t.Errorf("unexpected query %q", gotQuery)
+	}
+	if gotBody.SystemInstruction == nil || len(gotBody.Contents) != 1 {
+		t.Errorf("expected system instruction and one content, got %+v", gotBody)
+	}
+	if config := gotBody.GenerationConfig; config.Temperature == nil || *config.Temperature != 0.2 || config.Seed == nil || *config.Seed != 7 {
+		t.Errorf("sampling parameters missing from generationConfig: %+v", config)
+	}
+}
+
+// Test a conversation with tool calls from another provider is converted to
+// function calls and responses that are matched by name.
+func TestConvertMessagesFromOtherProvider(t *testing.T) {
+	conversation := []llm.Message{
+		llm.User("weather?"),
+		{Role: "assistant", ToolCalls: []llm.ToolCall{
+			{Id: "call_1", Name: "get_weather", Arguments: `{"city":"Amsterdam"}`},
+			{Id: "call_2", Name: "get_time", Arguments: ``},
+		}},
+		{Role: "tool", ToolCallId: "call_1", Content: `"sunny"`},
+		{Role: "tool", ToolCallId: "call_2", Content: `"noon"`},
+	}
+
+	contents, _, err := convertMessages(conversation)
+	if err != nil {
+		t.Fatalf("convertMessages returned error: %v", err)
+	}
+	if len(contents) != 3 {
+		t.Fatalf("expected user, model and function response contents, got %d", len(contents))
+	}
+
+	calls := contents[1].Parts
+	if len(calls) != 2 || calls[0].FunctionCall.Name != "get_weather" || string(calls[1].FunctionCall.Args) != "{}" {
+		t.Errorf("unexpected function calls %+v", calls)
+	}
+	results := contents[2].Parts
+	if len(results) != 2 || results[0].FunctionResponse.Name != "get_weather" || results[1].FunctionResponse.Name != "get_time" {
+		t.Errorf("function responses not matched by name %+v", results)
+	}
+}
+
+// Test a forced tool call is send as functionCallingConfig and only applies to
+// the first request, so the model can answer after the tool result.
+func TestPromptToolChoice(t *testing.T) {
+	os.Setenv("GOOGLE_AI_STUDIO_KEY", "test-key")
+	defer os.Unsetenv("GOOGLE_AI_STUDIO_KEY")
+
+	var toolConfigs []*ToolConfig
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ToolConfig *ToolConfig `json:"toolConfig"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		toolConfigs = append(toolConfigs, body.ToolConfig)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(toolConfigs) == 1 {
+			w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"extract","args":{"name":"Ada"}}}]},"finishReason":"STOP"}]}`))
+			return
+		}
+		w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"done"}]},"finishReason":"STOP"}]}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	var gotArgs string
+	tools := []llm.Tool{
+		{Function: llm.FunctionDef{Name: "other"}, Resolver: func(json.RawMessage) (any, error) { return nil, nil }},
+		{Function: llm.FunctionDef{Name: "extract"}, Resolver: func(args json.RawMessage) (any, error) {
+			gotArgs = string(args)
+			return "ok", nil
+		}},
+	}
+	resp, err := (&Provider{}).Prompt("gemini-test", []llm.Message{llm.User("Ada is 36")}, llm.Options{Tools: tools, ToolChoice: llm.CallTool("extract")})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if resp.Value != "done" || gotArgs != `{"name":"Ada"}` {
+		t.Errorf("expected the tool to be resolved before the answer, got %q and args %q", resp.Value, gotArgs)
+	}
+	if len(toolConfigs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(toolConfigs))
+	}
+	first := toolConfigs[0]
+	if first == nil || first.FunctionCallingConfig.Mode != "ANY" || len(first.FunctionCallingConfig.AllowedFunctionNames) != 1 || first.FunctionCallingConfig.AllowedFunctionNames[0] != "extract" {
+		t.Errorf("unexpected tool config of the first request %+v", first)
+	}
+	if toolConfigs[1] != nil {
+		t.Errorf("expected the second request to let the model decide, got %+v", toolConfigs[1])
+	}
+}
+
+// Test the parameters of a tool are converted to the OpenAPI subset Gemini accepts.
+func TestConvertToolsParameters(t *testing.T) {
+	tool := llm.MustNewTool("lookup", "", func(ctx context.Context, args struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit,omitempty" max:"10"`
+	}) (string, error) {
+		return "", nil
+	})
+
+	tools, err := convertTools([]llm.Tool{tool})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got := string(tools[0].FunctionDeclarations[0].Parameters)
+	if strings.Contains(got, "additionalProperties") || !strings.Contains(got, `"nullable":true`) || !strings.Contains(got, `"maximum":10`) {
+		t.Errorf("unexpected parameters %s", got)
+	}
+
+	// Parameters Gemini can not represent are an error instead of being send as is
+	recursive := llm.Tool{Function: llm.FunctionDef{Name: "tree", Parameters: json.RawMessage(`{"type":"object","properties":{"child":{"$ref":"#"}}}`)}}
+	if _, err := convertTools([]llm.Tool{recursive}); err == nil || !strings.Contains(err.Error(), "tree") {
+		t.Errorf("expected an error for the recursive parameters, got %v", err)
+	}
+}
+
+// Test references to shared definitions are inlined and recursive ones are rejected.
+func TestConvertResponseSchemaRefs(t *testing.T) {
+	got, err := convertResponseSchema(json.RawMessage(`{"type":"object","properties":{"home":{"$ref":"#/$defs/address"},"work":{"$ref":"#/$defs/address"}},"$defs":{"address":{"type":"object","properties":{"city":{"type":"string"}}}}}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := `{"properties":{"home":{"properties":{"city":{"type":"string"}},"type":"object"},"work":{"properties":{"city":{"type":"string"}},"type":"object"}},"type":"object"}`
+	if string(got) != want {
+		t.Errorf("unexpected schema:\n got  %s\n want %s", got, want)
+	}
+
+	_, err = convertResponseSchema(json.RawMessage(`{"$ref":"#/$defs/node","$defs":{"node":{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#/$defs/node"}}}}}}`))
+	if err == nil || !strings.Contains(err.Error(), "recursive") {
+		t.Errorf("expected an error for a recursive schema, got %v", err)
+	}
+	_, err = convertResponseSchema(json.RawMessage(`{"$ref":"https://example.com/schema.json"}`))
+	if err == nil {
+		t.Error("expected an error for a remote reference")
+	}
+}
+
+// Test enums are converted to the string enums Gemini accepts and schemas without a type are rejected.
+func TestConvertResponseSchemaEnums(t *testing.T) {
+	got, err := convertResponseSchema(json.RawMessage(`{"type":"object","properties":{` +
+		`"label":{"type":["string","null"],"enum":["low","high",null]},` +
+		`"priority":{"type":["integer","null"],"enum":[1,2,3]},` +
+		`"size":{"enum":["s","m"]}}}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := `{"properties":{` +
+		`"label":{"enum":["low","high"],"nullable":true,"type":"string"},` +
+		`"priority":{"nullable":true,"type":"integer"},` +
+		`"size":{"enum":["s","m"],"type":"string"}},"type":"object"}`
+	if string(got) != want {
+		t.Errorf("unexpected schema:\n got  %s\n want %s", got, want)
+	}
+
+	// Like the schema of an interface{} or json.RawMessage field
+	_, err = convertResponseSchema(json.RawMessage(`{"type":"object","properties":{"data":{}}}`))
+	if err == nil || !strings.Contains(err.Error(), "$.data") {
+		t.Errorf("expected an error for the schema without a type, got %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package googleaistudio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// supportedSchemaKeys lists the JSON Schema keywords that Gemini's OpenAPI
+// based responseSchema understands, anything else is rejected by the API.
+var supportedSchemaKeys = map[string]bool{
+	"type":             true,
+	"format":           true,
+	"title":            true,
+	"description":      true,
+	"nullable":         true,
+	"enum":             true,
+	"properties":       true,
+	"required":         true,
+	"propertyOrdering": true,
+	"items":            true,
+	"minItems":         true,
+	"maxItems":         true,
+	"minimum":          true,
+	"maximum":          true,
+	"minLength":        true,
+	"maxLength":        true,
+	"pattern":          true,
+	"anyOf":            true,
+}
+
+// convertResponseSchema converts a JSON Schema into the subset accepted by
+// generationConfig.responseSchema. Local references to $defs or definitions
+// are inlined, recursive references can not be expressed and return an error.
+// Gemini only accepts string enums, null is replaced by nullable and other
+// enums are dropped, they are still checked when the answer is validated.
+// Schemas without a type, like the one of an interface{} field, return an error.
+func convertResponseSchema(schema json.RawMessage) (json.RawMessage, error) {
+	var parsed any
+	if err := json.Unmarshal(schema, &parsed); err != nil {
+		return nil, fmt.Errorf("parsing json schema: %w", err)
+	}
+
+	sanitizer := schemaSanitizer{resolving: map[string]bool{}}
+	if root, ok := parsed.(map[string]any); ok {
+		sanitizer.root = root
+	}
+	sanitized, err := sanitizer.sanitize("$", parsed)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sanitized)
+}
+
+type schemaSanitizer struct {
+	root      map[string]any
+	resolving map[string]bool // The references being inlined, to detect recursion
+}
+
+// resolve returns the definition a local reference like #/$defs/Name points to
+func (s *schemaSanitizer) resolve(ref string) (any, error) {
+	path, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, fmt.Errorf("json schema reference %q is not supported, only local references can be inlined", ref)
+	}
+
+	var current any = s.root
+	for _, segment := range strings.Split(path, "/") {
+		segment = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("json schema reference %q not found", ref)
+		}
+		current, ok = object[segment]
+		if !ok {
+			return nil, fmt.Errorf("json schema reference %q not found", ref)
+		}
+	}
+	return current, nil
+}
+
+func (s *schemaSanitizer) sanitize(path string, value any) (any, error) {
+	schema, ok := value.(map[string]any)
+	if !ok {
+		return value, nil
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		if s.resolving[ref] {
+			return nil, fmt.Errorf("json schema reference %q is recursive, gemini does not support recursive schemas", ref)
+		}
+		definition, err := s.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		s.resolving[ref] = true
+		defer delete(s.resolving, ref)
+		return s.sanitize(path, definition)
+	}
+
+	out := map[string]any{}
+	for key, value := range schema {
+		if !supportedSchemaKeys[key] {
+			continue
+		}
+
+		switch key {
+		case "type":
+			// JSON Schema allows ["string", "null"], Gemini wants a single type with nullable set
+			types, ok := value.([]any)
+			if !ok {
+				out[key] = value
+				continue
+			}
+			for _, t := range types {
+				if t == "null" {
+					out["nullable"] = true
+				} else {
+					out[key] = t
+				}
+			}
+		case "properties":
+			properties, ok := value.(map[string]any)
+			if !ok {
+				continue
+			}
+			sanitized := map[string]any{}
+			for name, property := range properties {
+				var err error
+				sanitized[name], err = s.sanitize(path+"."+name, property)
+				if err != nil {
+					return nil, err
+				}
+			}
+			out[key] = sanitized
+		case "items":
+			items, err := s.sanitize(path+"[]", value)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = items
+		case "anyOf":
+			options, ok := value.([]any)
+			if !ok {
+				continue
+			}
+			sanitized := make([]any, len(options))
+			for idx, option := range options {
+				var err error
+				sanitized[idx], err = s.sanitize(fmt.Sprintf("%s.anyOf[%d]", path, idx), option)
+				if err != nil {
+					return nil, err
+				}
+			}
+			out[key] = sanitized
+		case "enum":
+			// Set after the loop, it depends on the type
+		default:
+			out[key] = value
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		convertEnum(out, enum)
+	}
+	if _, ok := out["type"]; !ok && out["anyOf"] == nil {
+		return nil, fmt.Errorf("json schema %s has no type, gemini does not support schemas that allow any value", path)
+	}
+
+	return out, nil
+}
+
+// convertEnum sets the enum of a converted schema, a null option makes the
+// schema nullable and enums with other values than strings are left out
+func convertEnum(out map[string]any, enum []any) {
+	values := []any{}
+	for _, value := range enum {
+		switch value.(type) {
+		case nil:
+			out["nullable"] = true
+		case string:
+			values = append(values, value)
+		default:
+			return
+		}
+	}
+	if len(values) > 0 {
+		out["enum"] = values
+		if _, ok := out["type"]; !ok {
+			out["type"] = "string"
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 
 	"github.com/Back-to-code/go-llm"
-	"github.com/Back-to-code/go-llm/log"
 )
 
 // Gemini tool definition types
@@ -21,6 +20,15 @@ type GeminiTool struct {
 	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
 }
 
+type ToolConfig struct {
+	FunctionCallingConfig FunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type FunctionCallingConfig struct {
+	Mode                 string   `json:"mode"` // AUTO, ANY or NONE
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
 // Gemini part types for function calling
 
 type FunctionCall struct {
@@ -39,111 +47,130 @@ type FunctionResponseOutput struct {
 
 // convertTools transforms the common llm.Tool definitions into Gemini's
 // functionDeclarations format.
-func convertTools(tools []llm.Tool) []GeminiTool {
+func convertTools(tools []llm.Tool) ([]GeminiTool, error) {
 	if len(tools) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	declarations := make([]GeminiFunctionDeclaration, len(tools))
 	for i, tool := range tools {
+		parameters := tool.Function.Parameters
+		if len(parameters) > 0 {
+			// Parameters use the same OpenAPI subset as the response schema, like nullable instead of a null type
+			converted, err := convertResponseSchema(parameters)
+			if err != nil {
+				return nil, fmt.Errorf("parameters of tool %s: %w", tool.Function.Name, err)
+			}
+			parameters = converted
+		}
 		declarations[i] = GeminiFunctionDeclaration{
 			Name:        tool.Function.Name,
 			Description: tool.Function.Description,
-			Parameters:  tool.Function.Parameters,
+			Parameters:  parameters,
 		}
 	}
 
-	return []GeminiTool{{FunctionDeclarations: declarations}}
+	return []GeminiTool{{FunctionDeclarations: declarations}}, nil
 }
 
-// resolveToolCalls executes the function calls from the model's response and
-// returns a slice of FunctionResponse parts to send back. It matches each
-// functionCall by name against the provided tools and calls the Resolver.
-func resolveToolCalls(calls []Part, tools []llm.Tool) ([]FunctionResponse, error) {
-	responses := make([]FunctionResponse, 0, len(calls))
-
-	for _, call := range calls {
-		functionCall := call.FunctionCall
-		if functionCall == nil {
-			continue
-		}
-
-		log.Info("llm tool call " + functionCall.Name)
-
-		var matched *llm.Tool
-		for i := range tools {
-			if tools[i].Function.Name == functionCall.Name {
-				matched = &tools[i]
-				break
-			}
-		}
-
-		if matched == nil {
-			responses = append(responses, FunctionResponse{
-				Name: functionCall.Name,
-				Response: FunctionResponseOutput{
-					Output: "error: tool not found: " + functionCall.Name,
-				},
-			})
-			continue
-		}
-
-		result, err := matched.Resolver(functionCall.Args)
-		if err != nil {
-			responses = append(responses, FunctionResponse{
-				Name: functionCall.Name,
-				Response: FunctionResponseOutput{
-					Output: "error: " + err.Error(),
-				},
-			})
-			continue
-		}
+// convertToolChoice returns nil for the default, letting the model decide
+func convertToolChoice(choice llm.ToolChoice) *ToolConfig {
+	var config FunctionCallingConfig
+	switch choice.Mode {
+	case llm.ToolChoiceAuto:
+		config.Mode = "AUTO"
+	case llm.ToolChoiceNone:
+		config.Mode = "NONE"
+	case llm.ToolChoiceRequired:
+		config.Mode = "ANY"
+	case llm.ToolChoiceFunction:
+		config.Mode = "ANY"
+		config.AllowedFunctionNames = []string{choice.Function}
+	default:
+		return nil
+	}
+	return &ToolConfig{FunctionCallingConfig: config}
+}
 
-		resultJson, err := json.Marshal(result)
-		if err != nil {
-			responses = append(responses, FunctionResponse{
-				Name: functionCall.Name,
-				Response: FunctionResponseOutput{
-					Output: "error: " + err.Error(),
-				},
-			})
-			continue
+// appendPart adds a part of the answer to the round, a function call becomes a
+// tool call which is returned. Gemini has no call ids so they are generated.
+func appendPart(round *llm.RoundResult, part Part) *llm.ToolCall {
+	switch {
+	case part.FunctionCall != nil:
+		if part.ThoughtSignature != "" && round.Message.ThoughtSignature == "" {
+			round.Message.ThoughtSignature = part.ThoughtSignature
 		}
-
-		responses = append(responses, FunctionResponse{
-			Name: functionCall.Name,
-			Response: FunctionResponseOutput{
-				Output: string(resultJson),
-			},
+		round.Message.ToolCalls = append(round.Message.ToolCalls, llm.ToolCall{
+			Id:        llm.NewToolCallId(),
+			Name:      part.FunctionCall.Name,
+			Arguments: string(part.FunctionCall.Args),
 		})
+		return &round.Message.ToolCalls[len(round.Message.ToolCalls)-1]
+	case part.Thought:
+		round.Reasoning += part.Text
+	default:
+		round.Message.Content += part.Text
 	}
+	return nil
+}
 
-	return responses, nil
+// toStopReason maps the finishReason of a candidate
+func toStopReason(finishReason string) llm.StopReason {
+	switch finishReason {
+	case "MAX_TOKENS":
+		return llm.StopMaxTokens
+	case "RECITATION":
+		return llm.StopContentFilter
+	}
+	return llm.StopCompleted
 }
 
 // convertMessages transforms the common llm.Message slice into Gemini Content
 // objects, handling all role types including tool-related messages.
 func convertMessages(messages []llm.Message) (contents []Content, systemParts []Part, err error) {
+	toolNames := llm.ToolCallNames(messages)
 	for _, message := range messages {
 		switch message.Role {
 		case "system":
 			systemParts = append(systemParts, Part{Text: message.Content})
 
 		case "user":
+			parts := []Part{}
+			if message.Content != "" || len(message.Parts) == 0 {
+				parts = append(parts, Part{Text: message.Content})
+			}
+			for _, part := range message.Parts {
+				switch {
+				case part.Type == llm.PartText:
+					parts = append(parts, Part{Text: part.Text})
+				case len(part.Data) > 0:
+					parts = append(parts, Part{InlineData: &Blob{MimeType: part.MimeType, Data: part.Data}})
+				default:
+					parts = append(parts, Part{FileData: &FileData{MimeType: part.MimeType, FileUri: part.URL}})
+				}
+			}
+
 			contents = append(contents, Content{
 				Role:  "user",
-				Parts: []Part{{Text: message.Content}},
+				Parts: parts,
 			})
 
 		case "assistant":
-			parts := []Part{{Text: message.Content}}
-			if len(message.ToolCalls) > 0 {
-				// This is a model turn that contained function calls.
-				// Deserialize the stored tool calls back into Part objects.
-				parts = []Part{}
-				if err := json.Unmarshal(message.ToolCalls, &parts); err != nil {
-					return nil, nil, fmt.Errorf("unmarshaling tool calls: %w", err)
+			parts := []Part{}
+			if message.Content != "" || len(message.ToolCalls) == 0 {
+				parts = append(parts, Part{Text: message.Content})
+			}
+			for idx, toolCall := range message.ToolCalls {
+				args := json.RawMessage(toolCall.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
 				}
+				part := Part{FunctionCall: &FunctionCall{Name: toolCall.Name, Args: args}}
+				if idx == 0 {
+					// The signature belongs to the first function call of a turn
+					part.ThoughtSignature = message.ThoughtSignature
+				}
+				parts = append(parts, part)
 			}
 
 			contents = append(contents, Content{
@@ -151,8 +178,13 @@ func convertMessages(messages []llm.Message) (contents []Content, systemParts []
 				Parts: parts,
 			})
 		case "tool":
+			// Gemini matches the results by function name instead of call id
+			name, ok := toolNames[message.ToolCallId]
+			if !ok {
+				name = message.ToolCallId
+			}
 			part := Part{FunctionResponse: &FunctionResponse{
-				Name:     message.ToolCallId,
+				Name:     name,
 				Response: FunctionResponseOutput{Output: message.Content},
 			}}
 			if len(contents) > 0 {
@@ -1,48 +1,33 @@
 package inception
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"time"
-
+	"github.com/Back-to-code/go-llm"
 	apikey "github.com/Back-to-code/go-llm/apikeys"
+	"github.com/Back-to-code/go-llm/openai"
 )
 
 // BaseURL is the Inception Labs API base URL. Exported for test overrides.
 var BaseURL = "https://api.inceptionlabs.ai"
 
-func newRequest(path string, body any, timeout time.Duration, ctx context.Context) (*http.Response, error) {
-	jsonData, err := json.Marshal(body)
-	if err != nil {
-		return nil, fmt.Errorf("error marshaling JSON: %v", err)
-	}
-
-	var req *http.Request
-	if ctx == nil {
-		req, err = http.NewRequest("POST", BaseURL+path, bytes.NewBuffer(jsonData))
-	} else {
-		req, err = http.NewRequestWithContext(ctx, "POST", BaseURL+path, bytes.NewBuffer(jsonData))
-	}
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
-	}
-
-	apiKey, err := apikey.Inception()
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+// compatible returns the OpenAI compatible provider for the Inception API, it
+// is created for every request so changes to BaseURL are picked up
+func compatible() *openai.Compatible {
+	return openai.NewCompatible(openai.Config{
+		Name:             "inception",
+		BaseURL:          BaseURL,
+		ApiKey:           apikey.Inception,
+		MaxTokensCeiling: maxTokensCeiling,
+		ReasoningEffort: func(_ string, thinking llm.Thinking) string {
+			return reasoningEffort(thinking)
+		},
+		Sampling: sampling,
+	})
+}
 
-	if timeout == 0 {
-		timeout = time.Second * 30
+// sampling clamps the temperature to the range the Inception API accepts
+func sampling(_ string, _ llm.Thinking, sampling openai.Sampling) openai.Sampling {
+	if sampling.Temperature != nil {
+		sampling.Temperature = llm.Ptr(min(max(*sampling.Temperature, 0.5), 1.0))
 	}
-
-	return (&http.Client{
-		Timeout: timeout,
-	}).Do(req)
+	return sampling
 }
@@ -0,0 +1,607 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// schemaNode is a small subset of JSON Schema that covers everything we can
+// derive from Go types and everything we validate against
+type schemaNode struct {
+	Type                 []string
+	Format               string
+	Description          string
+	Enum                 []any
+	Properties           map[string]*schemaNode
+	PropertyOrder        []string
+	Required             []string
+	Optional             map[string]bool // Properties in Required that may still be left out, strict mode requires every property to be listed
+	AdditionalProperties *schemaNode     // Only used for maps, structs never allow additional properties
+	Items                *schemaNode
+
+	// Set by the min and max tags, the keyword depends on the type
+	Minimum, Maximum     *float64
+	MinLength, MaxLength *int
+	MinItems, MaxItems   *int
+}
+
+func (s *schemaNode) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBufferString("{")
+	first := true
+	write := func(key string, value any) error {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		buf.WriteString(strconv.Quote(key))
+		buf.WriteByte(':')
+		buf.Write(encoded)
+		return nil
+	}
+
+	var err error
+	switch len(s.Type) {
+	case 0:
+	case 1:
+		err = write("type", s.Type[0])
+	default:
+		err = write("type", s.Type)
+	}
+	if err == nil && s.Format != "" {
+		err = write("format", s.Format)
+	}
+	if err == nil && s.Description != "" {
+		err = write("description", s.Description)
+	}
+	if err == nil && len(s.Enum) > 0 {
+		err = write("enum", s.Enum)
+	}
+	for _, limit := range []struct {
+		key   string
+		value any
+		set   bool
+	}{
+		{"minimum", s.Minimum, s.Minimum != nil},
+		{"maximum", s.Maximum, s.Maximum != nil},
+		{"minLength", s.MinLength, s.MinLength != nil},
+		{"maxLength", s.MaxLength, s.MaxLength != nil},
+		{"minItems", s.MinItems, s.MinItems != nil},
+		{"maxItems", s.MaxItems, s.MaxItems != nil},
+	} {
+		if err == nil && limit.set {
+			err = write(limit.key, limit.value)
+		}
+	}
+	if err == nil && s.Items != nil {
+		err = write("items", s.Items)
+	}
+	if err == nil && s.hasType("object") {
+		if s.Properties != nil {
+			// Write the properties in field order, the models generate them in the same order
+			props := bytes.NewBufferString("{")
+			for idx, name := range s.PropertyOrder {
+				encoded, err := json.Marshal(s.Properties[name])
+				if err != nil {
+					return nil, err
+				}
+				if idx > 0 {
+					props.WriteByte(',')
+				}
+				props.WriteString(strconv.Quote(name))
+				props.WriteByte(':')
+				props.Write(encoded)
+			}
+			props.WriteByte('}')
+			err = write("properties", json.RawMessage(props.Bytes()))
+			if err == nil {
+				err = write("required", append([]string{}, s.Required...))
+			}
+		}
+		if err == nil {
+			if s.AdditionalProperties != nil {
+				err = write("additionalProperties", s.AdditionalProperties)
+			} else {
+				err = write("additionalProperties", false)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (s *schemaNode) hasType(t string) bool {
+	for _, typ := range s.Type {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+type schemaBuilder struct {
+	visiting map[reflect.Type]bool
+	// strict is set to false when the schema contains constructs that the strict mode of providers cannot enforce
+	strict bool
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (b *schemaBuilder) build(t reflect.Type) (*schemaNode, error) {
+	switch t {
+	case timeType:
+		return &schemaNode{Type: []string{"string"}, Format: "date-time"}, nil
+	case rawMessageType:
+		b.strict = false
+		return &schemaNode{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		node, err := b.build(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		if len(node.Type) > 0 && !node.hasType("null") {
+			node.Type = append(node.Type, "null")
+		}
+		return node, nil
+	case reflect.String:
+		return &schemaNode{Type: []string{"string"}}, nil
+	case reflect.Bool:
+		return &schemaNode{Type: []string{"boolean"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schemaNode{Type: []string{"integer"}}, nil
+	case reflect.Float32, reflect.Float64:
+		return &schemaNode{Type: []string{"number"}}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Mirrors encoding/json that encodes []byte as a base64 string
+			return &schemaNode{Type: []string{"string"}}, nil
+		}
+		items, err := b.build(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &schemaNode{Type: []string{"array"}, Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map key type %s is not supported, only string keys can be represented in json", t.Key())
+		}
+		values, err := b.build(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		b.strict = false
+		return &schemaNode{Type: []string{"object"}, AdditionalProperties: values}, nil
+	case reflect.Interface:
+		b.strict = false
+		return &schemaNode{}, nil
+	case reflect.Struct:
+		return b.buildStruct(t)
+	}
+
+	return nil, fmt.Errorf("type %s cannot be represented as json schema", t)
+}
+
+func (b *schemaBuilder) buildStruct(t reflect.Type) (*schemaNode, error) {
+	if b.visiting[t] {
+		// Recursive types cannot be expressed without $ref, allow anything
+		b.strict = false
+		return &schemaNode{}, nil
+	}
+	b.visiting[t] = true
+	defer delete(b.visiting, t)
+
+	node := &schemaNode{
+		Type:       []string{"object"},
+		Properties: map[string]*schemaNode{},
+	}
+	err := b.addFields(node, t)
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (b *schemaBuilder) addFields(node *schemaNode, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name, jsonOpts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && jsonOpts == "" {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				err := b.addFields(node, embedded)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property, err := b.build(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if description := field.Tag.Get("description"); description != "" {
+			property.Description = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property.Enum, err = parseEnumTag(enum, field.Type)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+
+		for _, tag := range []string{"min", "max"} {
+			if value := field.Tag.Get(tag); value != "" {
+				err = b.setLimit(property, field.Type, tag, value)
+				if err != nil {
+					return fmt.Errorf("field %s: %w", field.Name, err)
+				}
+			}
+		}
+
+		required := !strings.Contains(","+jsonOpts+",", ",omitempty,")
+		if tag := field.Tag.Get("required"); tag != "" {
+			required, err = strconv.ParseBool(tag)
+			if err != nil {
+				return fmt.Errorf("field %s: invalid required tag: %w", field.Name, err)
+			}
+		}
+		if !required && len(property.Type) > 0 && !property.hasType("null") {
+			// Strict mode requires every property to be listed as required,
+			// optional properties are therefore expressed as nullable
+			property.Type = append(property.Type, "null")
+		}
+		if len(property.Enum) > 0 && property.hasType("null") && property.hasType("string") {
+			// Other enums rely on the null type, providers only accept null in string enums
+			property.Enum = append(property.Enum, nil)
+		}
+
+		if _, exists := node.Properties[name]; !exists {
+			node.PropertyOrder = append(node.PropertyOrder, name)
+			node.Required = append(node.Required, name)
+		}
+		node.Properties[name] = property
+		if !required {
+			if node.Optional == nil {
+				node.Optional = map[string]bool{}
+			}
+			node.Optional[name] = true
+		} else {
+			delete(node.Optional, name)
+		}
+	}
+
+	return nil
+}
+
+// setLimit applies a min or max tag, it limits the value of numbers, the length
+// of strings and the number of items in slices
+func (b *schemaBuilder) setLimit(node *schemaNode, t reflect.Type, tag string, value string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s tag %q: %w", tag, value, err)
+		}
+		if tag == "min" {
+			node.Minimum = &number
+		} else {
+			node.Maximum = &number
+		}
+		return nil
+	}
+
+	length, err := strconv.Atoi(value)
+	if err != nil || length < 0 {
+		return fmt.Errorf("invalid %s tag %q, expected a length", tag, value)
+	}
+	switch {
+	case t.Kind() == reflect.String:
+		// The strict mode of providers does not support string lengths
+		b.strict = false
+		if tag == "min" {
+			node.MinLength = &length
+		} else {
+			node.MaxLength = &length
+		}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		if tag == "min" {
+			node.MinItems = &length
+		} else {
+			node.MaxItems = &length
+		}
+	default:
+		return fmt.Errorf("%s tag is not supported on %s", tag, t)
+	}
+	return nil
+}
+
+func parseEnumTag(tag string, t reflect.Type) ([]any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	values := strings.Split(tag, ",")
+	enum := make([]any, len(values))
+	for idx, value := range values {
+		value = strings.TrimSpace(value)
+		switch t.Kind() {
+		case reflect.String:
+			enum[idx] = value
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			number, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid enum value %q: %w", value, err)
+			}
+			enum[idx] = number
+		case reflect.Float32, reflect.Float64:
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid enum value %q: %w", value, err)
+			}
+			enum[idx] = number
+		default:
+			return nil, fmt.Errorf("enum tag is not supported on %s", t)
+		}
+	}
+	return enum, nil
+}
+
+// JsonSchemaFor derives a JSON Schema from the struct type T.
+//
+// The json tags are respected for property names, fields tagged with omitempty
+// or `required:"false"` become nullable and may be left out of the response. The `description` and `enum`
+// (comma separated) tags are added to the property schema. The `min` and `max`
+// tags limit numbers, the length of strings and the number of items in slices.
+func JsonSchemaFor[T any]() (*JsonSchema, error) {
+	schema, _, err := jsonSchemaForType(reflect.TypeFor[T]())
+	return schema, err
+}
+
+// jsonSchemaForType returns both the public schema and the parsed node that can be used for validation
+func jsonSchemaForType(t reflect.Type) (*JsonSchema, *schemaNode, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("json schema root must be a struct, got %s", t)
+	}
+
+	builder := &schemaBuilder{visiting: map[reflect.Type]bool{}, strict: true}
+	node, err := builder.build(t)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	schema, err := json.Marshal(node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &JsonSchema{
+		Name:   schemaName(t),
+		Schema: schema,
+		Strict: builder.strict,
+	}, node, nil
+}
+
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if idx := strings.IndexByte(name, '['); idx >= 0 {
+		name = name[:idx]
+	}
+	if name == "" {
+		return "response"
+	}
+
+	var result strings.Builder
+	for idx, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			if idx > 0 {
+				result.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		result.WriteRune(r)
+	}
+	return result.String()
+}
+
+// validate checks a decoded json value against the schema and returns the
+// first mismatch it finds
+func (s *schemaNode) validate(path string, value any) error {
+	if len(s.Type) > 0 {
+		matchesType := false
+		for _, typ := range s.Type {
+			if jsonValueHasType(value, typ) {
+				matchesType = true
+				break
+			}
+		}
+		if !matchesType {
+			return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(s.Type, " or "), jsonTypeName(value))
+		}
+	}
+	if value == nil {
+		return nil
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, option := range s.Enum {
+			if option != nil && fmt.Sprint(option) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			options := make([]string, 0, len(s.Enum))
+			for _, option := range s.Enum {
+				if option != nil {
+					options = append(options, fmt.Sprint(option))
+				}
+			}
+			return fmt.Errorf("%s: %v is not one of %s", path, value, strings.Join(options, ", "))
+		}
+	}
+
+	switch value := value.(type) {
+	case float64:
+		if s.Minimum != nil && value < *s.Minimum {
+			return fmt.Errorf("%s: %v is less than the minimum %v", path, value, *s.Minimum)
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			return fmt.Errorf("%s: %v is more than the maximum %v", path, value, *s.Maximum)
+		}
+	case string:
+		length := utf8.RuneCountInString(value)
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: must be at least %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: must be at most %d characters", path, *s.MaxLength)
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok && !s.Optional[name] {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for name, propertyValue := range value {
+			property, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil {
+					property = s.AdditionalProperties
+				} else if s.Properties != nil {
+					return fmt.Errorf("%s: unknown property %q", path, name)
+				} else {
+					continue
+				}
+			}
+			if err := property.validate(path+"."+name, propertyValue); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			return fmt.Errorf("%s: must have at least %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			return fmt.Errorf("%s: must have at most %d items", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for idx, item := range value {
+				if err := s.Items.validate(path+"["+strconv.Itoa(idx)+"]", item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func jsonValueHasType(value any, typ string) bool {
+	switch typ {
+	case "null":
+		return value == nil
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == float64(int64(number))
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	}
+	return true
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// decodeAndValidate parses data, validates it against the schema and decodes it into out
+func decodeAndValidate(schema *schemaNode, data []byte, out any) error {
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	if err := schema.validate("$", generic); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("$.%s: cannot use %s as %s", typeErr.Field, typeErr.Value, typeErr.Type)
+		}
+		return err
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Back-to-code/go-llm"
+	"github.com/Back-to-code/go-llm/anthropic"
 	"github.com/Back-to-code/go-llm/googleaistudio"
 	"github.com/Back-to-code/go-llm/inception"
 	"github.com/Back-to-code/go-llm/openai"
@@ -107,7 +108,7 @@ func TestOpenAI(t *testing.T) {
 	model := &llm.Model{Name: "gpt-5.4-nano", Provider: provider}
 
 	t.Run("PromptSingle", func(t *testing.T) {
-		resp, err := model.PromptSingle("Reply with only the word 'hello'.", llm.Options{NoRetry: true})
+		resp, err := model.PromptSingle("Reply with only the word 'hello'.", llm.Options{Retry: llm.NoRetry})
 		assertResponse(t, resp, err)
 		assertUsageNonZero(t, resp.Usage)
 
@@ -129,7 +130,7 @@ func TestOpenAI(t *testing.T) {
 			llm.System("You are a helpful assistant. Always reply in one short sentence."),
 			llm.User("What is 2+2?"),
 		}
-		resp, err := model.Prompt(messages, llm.Options{NoRetry: true})
+		resp, err := model.Prompt(messages, llm.Options{Retry: llm.NoRetry})
 		assertResponse(t, resp, err)
 		assertUsageNonZero(t, resp.Usage)
 
@@ -146,8 +147,8 @@ func TestOpenAI(t *testing.T) {
 				llm.User("What is the weather in Amsterdam?"),
 			},
 			llm.Options{
-				NoRetry: true,
-				Tools:   []llm.Tool{weatherTool()},
+				Retry: llm.NoRetry,
+				Tools: []llm.Tool{weatherTool()},
 			},
 		)
 		assertResponse(t, resp, err)
@@ -190,7 +191,7 @@ func TestOpenAI(t *testing.T) {
 		resp, err := model.PromptSingle(
 			`Return a JSON object with a single key "color" and value "blue". No other text.`,
 			llm.Options{
-				NoRetry:        true,
+				Retry:          llm.NoRetry,
 				ResponseFormat: llm.ResponseFormatJsonObject,
 			},
 		)
@@ -207,7 +208,7 @@ func TestOpenAI(t *testing.T) {
 	})
 
 	t.Run("YesNo", func(t *testing.T) {
-		result, err := llm.YesNo(model.PromptSingle("Is the sky blue? Reply with only yes or no.", llm.Options{NoRetry: true}))
+		result, err := llm.YesNo(model.PromptSingle("Is the sky blue? Reply with only yes or no.", llm.Options{Retry: llm.NoRetry}))
 		if err != nil {
 			t.Fatalf("expected no error, got: %v", err)
 		}
@@ -228,7 +229,7 @@ func TestGoogleAIStudio(t *testing.T) {
 	model := &llm.Model{Name: "gemini-3.1-flash-lite-preview", Provider: provider}
 
 	t.Run("PromptSingle", func(t *testing.T) {
-		resp, err := model.PromptSingle("Reply with only the word 'hello'.", llm.Options{NoRetry: true})
+		resp, err := model.PromptSingle("Reply with only the word 'hello'.", llm.Options{Retry: llm.NoRetry})
 		assertResponse(t, resp, err)
 		assertUsageNonZero(t, resp.Usage)
 
@@ -249,7 +250,7 @@ func TestGoogleAIStudio(t *testing.T) {
 			llm.System("You are a helpful assistant. Always reply in one short sentence."),
 			llm.User("What is 2+2?"),
 		}
-		resp, err := model.Prompt(messages, llm.Options{NoRetry: true})
+		resp, err := model.Prompt(messages, llm.Options{Retry: llm.NoRetry})
 		assertResponse(t, resp, err)
 		assertUsageNonZero(t, resp.Usage)
 
@@ -268,8 +269,8 @@ func TestGoogleAIStudio(t *testing.T) {
 				llm.User("What is the weather in Amsterdam?"),
 			},
 			llm.Options{
-				NoRetry: true,
-				Tools:   []llm.Tool{weatherTool()},
+				Retry: llm.NoRetry,
+				Tools: []llm.Tool{weatherTool()},
 			},
 		)
 		assertResponse(t, resp, err)
@@ -301,7 +302,7 @@ func TestGoogleAIStudio(t *testing.T) {
 		resp, err := model.PromptSingle(
 			`Return a JSON object with a single key "color" and value "blue". No other text.`,
 			llm.Options{
-				NoRetry:        true,
+				Retry:          llm.NoRetry,
 				ResponseFormat: llm.ResponseFormatJsonObject,
 			},
 		)
@@ -318,7 +319,7 @@ func TestGoogleAIStudio(t *testing.T) {
 	})
 
 	t.Run("YesNo", func(t *testing.T) {
-		result, err := llm.YesNo(model.PromptSingle("Is the sky blue? Reply with only yes or no.", llm.Options{NoRetry: true}))
+		result, err := llm.YesNo(model.PromptSingle("Is the sky blue? Reply with only yes or no.", llm.Options{Retry: llm.NoRetry}))
 		if err != nil {
 			t.Fatalf("expected no error, got: %v", err)
 		}
@@ -402,34 +403,50 @@ func TestTogetherAI(t *testing.T) {
 		}
 	})
 
-	// Together AI does not support tools, verify it errors correctly.
-	t.Run("ToolsUnsupported", func(t *testing.T) {
-		_, err := model.Prompt(
-			[]llm.Message{llm.User("What is the weather?")},
+	t.Run("PromptWithTools", func(t *testing.T) {
+		resp, err := model.Prompt(
+			[]llm.Message{
+				llm.System("You have access to a weather tool. Use it to answer the question. After getting the result, reply with a short sentence."),
+				llm.User("What is the weather in Amsterdam?"),
+			},
 			llm.Options{
-				NoRetry: true,
+				Timeout: 60 * time.Second,
 				Tools:   []llm.Tool{weatherTool()},
 			},
 		)
-		if err == nil {
-			t.Fatal("expected error when using tools with Together AI provider")
+		assertResponse(t, resp, err)
+		assertUsageNonZero(t, resp.Usage)
+
+		hasToolCall := false
+		hasToolResponse := false
+		for _, msg := range resp.Conversation {
+			if msg.Role == "assistant" && len(msg.ToolCalls) > 0 {
+				hasToolCall = true
+			}
+			if msg.Role == "tool" {
+				hasToolResponse = true
+			}
 		}
-		if !strings.Contains(err.Error(), "does not support tools") {
-			t.Errorf("expected 'does not support tools' error, got: %v", err)
+		if !hasToolCall {
+			t.Error("expected at least one assistant message with ToolCalls in conversation")
+		}
+		if !hasToolResponse {
+			t.Error("expected at least one tool response message in conversation")
 		}
 	})
 
-	// Together AI does not support streaming, verify it errors correctly.
-	t.Run("StreamUnsupported", func(t *testing.T) {
-		_, err := model.Stream(
-			[]llm.Message{llm.User("Hello")},
-			llm.Options{NoRetry: true},
-		)
-		if err == nil {
-			t.Fatal("expected error when using streaming with Together AI provider")
+	t.Run("Stream", func(t *testing.T) {
+		ch, err := model.Stream([]llm.Message{llm.User("Reply with only the word 'hello'.")}, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		var out strings.Builder
+		for delta := range ch {
+			out.WriteString(delta)
 		}
-		if !strings.Contains(err.Error(), "does not support streaming") {
-			t.Errorf("expected 'does not support streaming' error, got: %v", err)
+		if !strings.Contains(strings.ToLower(out.String()), "hello") {
+			t.Errorf("expected streamed response to contain 'hello', got: %q", out.String())
 		}
 	})
 }
@@ -445,7 +462,7 @@ func TestInception(t *testing.T) {
 	model := &llm.Model{Name: "mercury-2", Provider: provider}
 
 	t.Run("PromptSingle", func(t *testing.T) {
-		resp, err := model.PromptSingle("Reply with only the word 'hello'.", llm.Options{NoRetry: true})
+		resp, err := model.PromptSingle("Reply with only the word 'hello'.", llm.Options{Retry: llm.NoRetry})
 		assertResponse(t, resp, err)
 		assertUsageNonZero(t, resp.Usage)
 
@@ -466,7 +483,7 @@ func TestInception(t *testing.T) {
 			llm.System("You are a helpful assistant. Always reply in one short sentence."),
 			llm.User("What is 2+2?"),
 		}
-		resp, err := model.Prompt(messages, llm.Options{NoRetry: true})
+		resp, err := model.Prompt(messages, llm.Options{Retry: llm.NoRetry})
 		assertResponse(t, resp, err)
 		assertUsageNonZero(t, resp.Usage)
 
@@ -482,8 +499,8 @@ func TestInception(t *testing.T) {
 				llm.User("What is the weather in Amsterdam?"),
 			},
 			llm.Options{
-				NoRetry: true,
-				Tools:   []llm.Tool{weatherTool()},
+				Retry: llm.NoRetry,
+				Tools: []llm.Tool{weatherTool()},
 			},
 		)
 		assertResponse(t, resp, err)
@@ -515,7 +532,7 @@ func TestInception(t *testing.T) {
 		resp, err := model.PromptSingle(
 			`Return a JSON object with a single key "color" and value "blue". No other text.`,
 			llm.Options{
-				NoRetry:        true,
+				Retry:          llm.NoRetry,
 				ResponseFormat: llm.ResponseFormatJsonObject,
 			},
 		)
@@ -532,7 +549,86 @@ func TestInception(t *testing.T) {
 	})
 
 	t.Run("YesNo", func(t *testing.T) {
-		result, err := llm.YesNo(model.PromptSingle("Is the sky blue? Reply with only yes or no.", llm.Options{NoRetry: true}))
+		result, err := llm.YesNo(model.PromptSingle("Is the sky blue? Reply with only yes or no.", llm.Options{Retry: llm.NoRetry}))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if !result {
+			t.Error("expected YesNo to return true for 'is the sky blue'")
+		}
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Anthropic
+// ---------------------------------------------------------------------------
+
+func TestAnthropic(t *testing.T) {
+	skipIfEnvMissing(t, "ANTHROPIC_API_KEY")
+
+	provider := &anthropic.Provider{}
+	model := &llm.Model{Name: "claude-haiku-4-5", Provider: provider}
+
+	t.Run("PromptSingle", func(t *testing.T) {
+		resp, err := model.PromptSingle("Reply with only the word 'hello'.", llm.Options{Retry: llm.NoRetry})
+		assertResponse(t, resp, err)
+		assertUsageNonZero(t, resp.Usage)
+
+		if !strings.Contains(strings.ToLower(resp.Value), "hello") {
+			t.Errorf("expected response to contain 'hello', got: %q", resp.Value)
+		}
+	})
+
+	t.Run("Prompt", func(t *testing.T) {
+		messages := []llm.Message{
+			llm.System("You are a helpful assistant. Always reply in one short sentence."),
+			llm.User("What is 2+2?"),
+		}
+		resp, err := model.Prompt(messages, llm.Options{Retry: llm.NoRetry})
+		assertResponse(t, resp, err)
+		assertUsageNonZero(t, resp.Usage)
+
+		if len(resp.Conversation) < 3 {
+			t.Fatalf("expected at least 3 messages in conversation, got %d", len(resp.Conversation))
+		}
+	})
+
+	t.Run("PromptWithTools", func(t *testing.T) {
+		resp, err := model.Prompt(
+			[]llm.Message{
+				llm.System("You have access to a weather tool. Use it to answer the question. After getting the result, reply with a short sentence."),
+				llm.User("What is the weather in Amsterdam?"),
+			},
+			llm.Options{
+				Retry: llm.NoRetry,
+				Tools: []llm.Tool{weatherTool()},
+			},
+		)
+		assertResponse(t, resp, err)
+		assertUsageNonZero(t, resp.Usage)
+
+		if len(resp.Conversation) < 5 {
+			t.Fatalf("expected at least 5 messages in conversation with tool calls, got %d", len(resp.Conversation))
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		ch, err := model.Stream([]llm.Message{llm.User("Reply with only the word 'hello'.")}, llm.Options{Retry: llm.NoRetry})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		var out strings.Builder
+		for delta := range ch {
+			out.WriteString(delta)
+		}
+		if !strings.Contains(strings.ToLower(out.String()), "hello") {
+			t.Errorf("expected streamed response to contain 'hello', got: %q", out.String())
+		}
+	})
+
+	t.Run("YesNo", func(t *testing.T) {
+		result, err := llm.YesNo(model.PromptSingle("Is the sky blue? Reply with only yes or no.", llm.Options{Retry: llm.NoRetry}))
 		if err != nil {
 			t.Fatalf("expected no error, got: %v", err)
 		}
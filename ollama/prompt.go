@@ -0,0 +1,332 @@
+package ollama
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/Back-to-code/go-llm"
+)
+
+type Message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Thinking  string     `json:"thinking,omitempty"`
+	Images    [][]byte   `json:"images,omitempty"` // Base64 encoded by encoding/json
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+type ToolCall struct {
+	Function struct {
+		Index     int             `json:"index,omitempty"`
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type RequestOptions struct {
+	NumPredict       int      `json:"num_predict,omitempty"`
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+}
+
+type ChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []Message       `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   json.RawMessage `json:"format,omitempty"`
+	Tools    []llm.Tool      `json:"tools,omitempty"`
+	Think    any             `json:"think,omitempty"`
+	Options  *RequestOptions `json:"options,omitempty"`
+}
+
+// ChatResponse is a full response, or a single line of a streamed response
+type ChatResponse struct {
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+	Error           string  `json:"error"`
+}
+
+func (r ChatResponse) usage() llm.TokenUsage {
+	return llm.TokenUsage{
+		InputTokens:  r.PromptEvalCount,
+		OutputTokens: r.EvalCount,
+	}
+}
+
+func toMessage(s llm.Message, toolNames map[string]string) (Message, error) {
+	message := Message{
+		Role:    s.Role,
+		Content: s.Content,
+	}
+
+	for _, part := range s.Parts {
+		switch {
+		case part.Type == llm.PartText && message.Content == "":
+			message.Content = part.Text
+		case part.Type == llm.PartText:
+			message.Content += "\n" + part.Text
+		case part.Type == llm.PartImage && len(part.Data) > 0:
+			message.Images = append(message.Images, part.Data)
+		case part.Type == llm.PartImage:
+			return message, errors.New("images can only be send as data")
+		default:
+			return message, errors.New("unsupported part type " + string(part.Type))
+		}
+	}
+
+	switch s.Role {
+	case "assistant":
+		for _, toolCall := range s.ToolCalls {
+			arguments := json.RawMessage(toolCall.Arguments)
+			if !json.Valid(arguments) {
+				arguments = json.RawMessage("{}")
+			}
+			ollamaToolCall := ToolCall{}
+			ollamaToolCall.Function.Name = toolCall.Name
+			ollamaToolCall.Function.Arguments = arguments
+			message.ToolCalls = append(message.ToolCalls, ollamaToolCall)
+		}
+	case "tool":
+		// Ollama has no call ids and matches tool results by name
+		message.ToolName = toolNames[s.ToolCallId]
+	}
+
+	return message, nil
+}
+
+// toToolCalls converts the tool calls of a response, Ollama has no call ids so they are generated
+func toToolCalls(ollamaToolCalls []ToolCall) []llm.ToolCall {
+	toolCalls := make([]llm.ToolCall, len(ollamaToolCalls))
+	for idx, toolCall := range ollamaToolCalls {
+		toolCalls[idx] = llm.ToolCall{
+			Id:        llm.NewToolCallId(),
+			Name:      toolCall.Function.Name,
+			Arguments: string(toolCall.Function.Arguments),
+		}
+	}
+	return toolCalls
+}
+
+func (p *Provider) createRequest(stream bool, model string, messages []llm.Message, options llm.Options) (io.ReadCloser, error) {
+	toolNames := llm.ToolCallNames(messages)
+	bodyMessages := make([]Message, len(messages))
+	for idx, msg := range messages {
+		message, err := toMessage(msg, toolNames)
+		if err != nil {
+			return nil, err
+		}
+		bodyMessages[idx] = message
+	}
+
+	reqBody := ChatRequest{
+		Model:    model,
+		Messages: bodyMessages,
+		Stream:   stream,
+		Tools:    options.Tools,
+		Think:    think(model, options.Thinking),
+	}
+
+	// Ollama has no tool choice, it can only leave out the tools
+	switch {
+	case options.ToolChoice.Mode == llm.ToolChoiceNone:
+		reqBody.Tools = nil
+	case options.ToolChoice.Forced():
+		return nil, errors.New("ollama can not force a tool call")
+	}
+
+	switch options.ResponseFormat {
+	case llm.ResponseFormatJsonObject:
+		reqBody.Format = json.RawMessage(`"json"`)
+	case llm.ResponseFormatJsonSchema:
+		reqBody.Format = options.JsonSchema.Schema
+	}
+
+	// Ollama has no logit bias
+	requestOptions := RequestOptions{
+		NumPredict:       options.MaxTokens,
+		Temperature:      options.Temperature,
+		TopP:             options.TopP,
+		Seed:             options.Seed,
+		Stop:             options.StopSequences,
+		PresencePenalty:  options.PresencePenalty,
+		FrequencyPenalty: options.FrequencyPenalty,
+	}
+	if !reflect.ValueOf(requestOptions).IsZero() {
+		reqBody.Options = &requestOptions
+	}
+
+	resp, err := p.newRequest("/api/chat", reqBody, options.Timeout, options.Ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send chat request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fullResponse, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, llm.NewAPIError("ollama", resp, fullResponse)
+	}
+
+	return resp.Body, nil
+}
+
+// Provider talks to a (local) Ollama server, no API key is needed
+type Provider struct {
+	// BaseURL of the Ollama server, defaults to the OLLAMA_HOST environment variable or DefaultBaseURL
+	BaseURL string
+}
+
+var _ llm.Provider = &Provider{}
+
+func (*Provider) SupportsStructuredOutput() bool {
+	return true
+}
+
+func (*Provider) SupportsJsonSchema() bool {
+	return true
+}
+
+func (*Provider) SupportsStreaming() bool {
+	return true
+}
+
+func (*Provider) SupportsTools() bool {
+	return true
+}
+
+// SupportsPart returns true for images, only vision models like llava or gemma3 can use them
+func (*Provider) SupportsPart(partType llm.PartType) bool {
+	return partType == llm.PartText || partType == llm.PartImage
+}
+
+func (p *Provider) Prompt(model string, messages []llm.Message, options llm.Options) (llm.Response, error) {
+	return llm.ToolLoop{
+		Options: options,
+		Round: func(messages []llm.Message, options llm.Options) (llm.RoundResult, error) {
+			return p.promptRound(model, messages, options)
+		},
+	}.Run(messages)
+}
+
+// promptRound sends a single request, the tool calls in the answer are resolved by the llm.ToolLoop
+func (p *Provider) promptRound(model string, messages []llm.Message, options llm.Options) (llm.RoundResult, error) {
+	resp, err := p.createRequest(false, model, messages, options)
+	if err != nil {
+		return llm.RoundResult{}, err
+	}
+	defer resp.Close()
+
+	respContent := ChatResponse{}
+	err = json.NewDecoder(resp).Decode(&respContent)
+	if err != nil {
+		return llm.RoundResult{}, fmt.Errorf("decoding response: %s", err.Error())
+	}
+	if respContent.Error != "" {
+		return llm.RoundResult{}, &llm.APIError{Provider: "ollama", Message: respContent.Error}
+	}
+
+	return llm.RoundResult{
+		Message: llm.Message{
+			Role:      "assistant",
+			Content:   respContent.Message.Content,
+			ToolCalls: toToolCalls(respContent.Message.ToolCalls),
+		},
+		Usage:        respContent.usage(),
+		StopReason:   toStopReason(respContent.DoneReason),
+		FinishReason: respContent.DoneReason,
+		Reasoning:    respContent.Message.Thinking,
+	}, nil
+}
+
+func (p *Provider) StreamEvents(model string, messages []llm.Message, options llm.Options) (chan llm.StreamEvent, error) {
+	resp, err := p.createRequest(true, model, messages, options)
+	if err != nil {
+		return nil, err
+	}
+
+	open := func(messages []llm.Message, options llm.Options) (io.ReadCloser, error) {
+		return p.createRequest(true, model, messages, options)
+	}
+	return llm.StreamToolLoop(resp, messages, options, open, readStream), nil
+}
+
+// toStopReason maps the done_reason of a chat response
+func toStopReason(doneReason string) llm.StopReason {
+	if doneReason == "length" {
+		return llm.StopMaxTokens
+	}
+	return llm.StopCompleted
+}
+
+// readStream parses the newline delimited json stream of /api/chat, forwards
+// it as events and returns the assistant message as a round of the tool loop
+func readStream(resp io.Reader, events chan llm.StreamEvent) (llm.RoundResult, error) {
+	round := llm.RoundResult{Message: llm.Message{Role: "assistant"}}
+
+	scanner := bufio.NewScanner(resp)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		chunk := ChatResponse{}
+		err := json.Unmarshal(line, &chunk)
+		if err != nil {
+			continue
+		}
+		if chunk.Error != "" {
+			return llm.RoundResult{}, &llm.APIError{Provider: "ollama", Message: chunk.Error}
+		}
+
+		if chunk.Message.Thinking != "" {
+			round.Reasoning += chunk.Message.Thinking
+			events <- llm.StreamEvent{Kind: llm.StreamReasoning, Text: chunk.Message.Thinking}
+		}
+		if chunk.Message.Content != "" {
+			round.Message.Content += chunk.Message.Content
+			events <- llm.StreamEvent{Kind: llm.StreamText, Text: chunk.Message.Content}
+		}
+
+		// Tool calls are not streamed in parts, every call arrives complete
+		for _, toolCall := range toToolCalls(chunk.Message.ToolCalls) {
+			streamToolCall := llm.StreamToolCall{
+				Index:     len(round.Message.ToolCalls),
+				Id:        toolCall.Id,
+				Name:      toolCall.Name,
+				Arguments: toolCall.Arguments,
+			}
+			round.Message.ToolCalls = append(round.Message.ToolCalls, toolCall)
+			events <- llm.StreamEvent{Kind: llm.StreamToolCallStarted, ToolCall: &llm.StreamToolCall{Index: streamToolCall.Index, Id: streamToolCall.Id, Name: streamToolCall.Name}}
+			events <- llm.StreamEvent{Kind: llm.StreamToolCallArgument, ToolCall: &llm.StreamToolCall{Index: streamToolCall.Index, Id: streamToolCall.Id, Name: streamToolCall.Name, Arguments: streamToolCall.Arguments}}
+			events <- llm.StreamEvent{Kind: llm.StreamToolCallFinished, ToolCall: &streamToolCall}
+		}
+
+		if chunk.Done {
+			round.Usage = chunk.usage()
+			round.FinishReason = chunk.DoneReason
+			round.StopReason = toStopReason(chunk.DoneReason)
+			events <- llm.StreamEvent{Kind: llm.StreamUsage, Usage: round.Usage}
+			events <- llm.StreamEvent{Kind: llm.StreamFinish, FinishReason: round.FinishReason, StopReason: round.StopReason}
+			return round, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return llm.RoundResult{}, fmt.Errorf("reading stream: %w", err)
+	}
+
+	return llm.RoundResult{}, errors.New("stream ended before done")
+}
@@ -0,0 +1,176 @@
+package ollama
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+// Test the json schema is send as format, tool calls are resolved and send
+// back by name and usage is summed over the rounds.
+func TestPromptToolsAndFormat(t *testing.T) {
+	var requests []ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("no authorization header expected")
+		}
+
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			w.Write([]byte(`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Amsterdam"}}}]},"done":true,"done_reason":"stop","prompt_eval_count":10,"eval_count":5}`))
+			return
+		}
+		w.Write([]byte(`{"message":{"role":"assistant","content":"{\"weather\":\"sunny\"}"},"done":true,"done_reason":"stop","prompt_eval_count":20,"eval_count":4}`))
+	}))
+	defer server.Close()
+
+	var gotArgs string
+	tools := []llm.Tool{{
+		Type:     "function",
+		Function: llm.FunctionDef{Name: "get_weather"},
+		Resolver: func(args json.RawMessage) (any, error) {
+			gotArgs = string(args)
+			return "sunny", nil
+		},
+	}}
+
+	schema := json.RawMessage(`{"type":"object","properties":{"weather":{"type":"string"}}}`)
+	p := &Provider{BaseURL: server.URL}
+	resp, err := p.Prompt("qwen3", []llm.Message{llm.User("weather?")}, llm.Options{
+		Tools:          tools,
+		ResponseFormat: llm.ResponseFormatJsonSchema,
+		JsonSchema:     &llm.JsonSchema{Name: "weather", Schema: schema},
+		Thinking:       llm.LowThinking,
+		MaxTokens:      100,
+	})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if resp.Value != `{"weather":"sunny"}` {
+		t.Errorf("Value = %q", resp.Value)
+	}
+	if gotArgs != `{"city":"Amsterdam"}` {
+		t.Errorf("wrong args threaded to resolver: %q", gotArgs)
+	}
+	want := llm.TokenUsage{InputTokens: 30, OutputTokens: 9}
+	if resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+
+	first := requests[0]
+	if string(first.Format) != string(schema) {
+		t.Errorf("format = %s, want the schema", first.Format)
+	}
+	if first.Think != true {
+		t.Errorf("think = %v, want true", first.Think)
+	}
+	if first.Options == nil || first.Options.NumPredict != 100 {
+		t.Errorf("num_predict not set: %+v", first.Options)
+	}
+
+	followUp := requests[1].Messages
+	if len(followUp) != 3 {
+		t.Fatalf("expected user, assistant and tool messages, got %d", len(followUp))
+	}
+	if len(followUp[1].ToolCalls) != 1 || followUp[1].ToolCalls[0].Function.Name != "get_weather" {
+		t.Errorf("assistant tool calls not send back: %+v", followUp[1])
+	}
+	if followUp[2].Role != "tool" || followUp[2].ToolName != "get_weather" || followUp[2].Content != `"sunny"` {
+		t.Errorf("tool result not send back by name: %+v", followUp[2])
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Errorf("expected stream to be set")
+		}
+		if string(req.Format) != `"json"` {
+			t.Errorf("format = %s, want json", req.Format)
+		}
+		if req.Think != "high" {
+			t.Errorf("think = %v, want high", req.Think)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte(`{"message":{"role":"assistant","content":"","thinking":"hmm"},"done":false}
+{"message":{"role":"assistant","content":"{\"a\":"},"done":false}
+{"message":{"role":"assistant","content":"1}"},"done":false}
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":7,"eval_count":3}
+`))
+	}))
+	defer server.Close()
+
+	p := &Provider{BaseURL: server.URL}
+	messages := []llm.Message{llm.User("json please")}
+	events, err := p.StreamEvents("gpt-oss:20b", messages, llm.Options{ResponseFormat: llm.ResponseFormatJsonObject, Thinking: llm.HighThinking})
+	if err != nil {
+		t.Fatalf("StreamEvents returned error: %v", err)
+	}
+
+	reasoning := ""
+	finishReason := ""
+	collected := make(chan llm.StreamEvent)
+	go func() {
+		defer close(collected)
+		for event := range events {
+			switch event.Kind {
+			case llm.StreamReasoning:
+				reasoning += event.Text
+			case llm.StreamFinish:
+				finishReason = event.FinishReason
+			}
+			collected <- event
+		}
+	}()
+
+	resp, err := llm.CollectStream(messages, collected)
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if resp.Value != `{"a":1}` {
+		t.Errorf("Value = %q", resp.Value)
+	}
+	if reasoning != "hmm" || finishReason != "stop" {
+		t.Errorf("reasoning = %q, finish reason = %q", reasoning, finishReason)
+	}
+	want := llm.TokenUsage{InputTokens: 7, OutputTokens: 3}
+	if resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+}
+
+// Test the stream reports an error line from the server
+func TestStreamEventsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message":{"role":"assistant","content":"hi"},"done":false}
+{"error":"model crashed"}
+`))
+	}))
+	defer server.Close()
+
+	p := &Provider{BaseURL: server.URL}
+	events, err := p.StreamEvents("llama3.2", []llm.Message{llm.User("hi")}, llm.Options{})
+	if err != nil {
+		t.Fatalf("StreamEvents returned error: %v", err)
+	}
+
+	_, err = llm.CollectStream(nil, events)
+	var apiErr *llm.APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "model crashed" {
+		t.Errorf("err = %v, want model crashed", err)
+	}
+}
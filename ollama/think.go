@@ -0,0 +1,35 @@
+package ollama
+
+import (
+	"strings"
+
+	"github.com/Back-to-code/go-llm"
+)
+
+// Models that cannot turn thinking off but accept a thinking level instead
+var thinkLevelModels = []string{
+	"gpt-oss",
+}
+
+// think returns the value for the think field, a bool for most models and a level for some
+func think(model string, thinking llm.Thinking) any {
+	model = strings.ToLower(model)
+
+	for _, modelNamePrefix := range thinkLevelModels {
+		if !strings.HasPrefix(model, modelNamePrefix) {
+			continue
+		}
+
+		switch thinking {
+		case llm.NoThinking, llm.MinimalThinking, llm.LowThinking:
+			return "low"
+		case llm.MediumThinking:
+			return "medium"
+		case llm.HighThinking:
+			return "high"
+		}
+	}
+
+	// Ollama only rejects think=true for models without thinking support, false is always accepted
+	return thinking > llm.NoThinking
+}
@@ -0,0 +1,58 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is used when neither Provider.BaseURL nor the OLLAMA_HOST environment variable is set
+var DefaultBaseURL = "http://localhost:11434"
+
+func (p *Provider) baseURL() string {
+	if p.BaseURL != "" {
+		return strings.TrimSuffix(p.BaseURL, "/")
+	}
+
+	host := strings.TrimSpace(os.Getenv("OLLAMA_HOST"))
+	if host == "" {
+		return DefaultBaseURL
+	}
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+func (p *Provider) newRequest(path string, body any, timeout time.Duration, ctx context.Context) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling JSON: %v", err)
+	}
+
+	var req *http.Request
+	url := p.baseURL() + path
+	if ctx == nil {
+		req, err = http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if timeout == 0 {
+		timeout = time.Second * 30
+	}
+
+	return (&http.Client{
+		Timeout: timeout,
+	}).Do(req)
+}
@@ -0,0 +1,125 @@
+package openai
+
+import (
+	"slices"
+
+	"github.com/Back-to-code/go-llm"
+	apikey "github.com/Back-to-code/go-llm/apikeys"
+)
+
+const (
+	MaxTokensField           = "max_tokens"
+	MaxCompletionTokensField = "max_completion_tokens"
+)
+
+// Config describes an API that implements the OpenAI chat completions spec,
+// like vLLM, LM Studio, OpenRouter, Groq or Azure OpenAI.
+// The zero values match what most of these APIs expect.
+type Config struct {
+	// Name of the API used in errors, defaults to "openai compatible"
+	Name string
+	// BaseURL of the API without the chat path, for example "https://openrouter.ai/api"
+	BaseURL string
+	// ChatPath defaults to /v1/chat/completions
+	ChatPath string
+
+	// ApiKey returns the key to authenticate with, no key is send when nil
+	ApiKey func() (string, error)
+	// AuthHeader defaults to Authorization
+	AuthHeader string
+	// AuthScheme is put in front of the key, defaults to Bearer for the Authorization header and to nothing for other headers
+	AuthScheme string
+	// Headers are added to every request
+	Headers map[string]string
+
+	// SystemRole is the role system messages are send with, defaults to system
+	SystemRole string
+	// MaxTokensField is the name of the max tokens field, MaxTokensField (default) or MaxCompletionTokensField
+	MaxTokensField string
+	// MaxTokensCeiling caps the requested max tokens if set
+	MaxTokensCeiling int
+	// StringContent sends the message content as a plain string instead of a list of content parts
+	StringContent bool
+	// Store is send as the store field if set
+	Store *bool
+	// Parts are the types of message parts the API accepts besides text, like llm.PartImage
+	Parts []llm.PartType
+	// StreamUsage requests the token usage at the end of a stream using stream_options
+	StreamUsage bool
+	// ParallelToolCalls sends Options.ParallelToolCalls as parallel_tool_calls, not all APIs accept the field
+	ParallelToolCalls bool
+
+	// ReasoningEffort maps the thinking option to a reasoning_effort, an empty string omits the field
+	ReasoningEffort func(model string, thinking llm.Thinking) string
+	// Reasoning maps the thinking option to a vendor specific reasoning field, nil omits the field
+	Reasoning func(model string, thinking llm.Thinking) any
+	// ReasoningWithTools also sends the reasoning fields when tools are used, not all APIs accept that combination
+	ReasoningWithTools bool
+
+	// Sampling adjusts the sampling parameters before they are send, for example to clamp them or drop the ones a model rejects
+	Sampling func(model string, thinking llm.Thinking, sampling Sampling) Sampling
+}
+
+// Compatible is a provider for any API that follows the OpenAI chat completions spec
+type Compatible struct {
+	Config Config
+}
+
+var _ llm.Provider = &Compatible{}
+
+func NewCompatible(config Config) *Compatible {
+	return &Compatible{Config: config}
+}
+
+func (*Compatible) SupportsStructuredOutput() bool {
+	return true
+}
+
+func (*Compatible) SupportsJsonSchema() bool {
+	return true
+}
+
+func (*Compatible) SupportsStreaming() bool {
+	return true
+}
+
+func (*Compatible) SupportsTools() bool {
+	return true
+}
+
+func (c *Compatible) SupportsPart(partType llm.PartType) bool {
+	return partType == llm.PartText || slices.Contains(c.Config.Parts, partType)
+}
+
+func (c *Compatible) name() string {
+	if c.Config.Name != "" {
+		return c.Config.Name
+	}
+	return "openai compatible"
+}
+
+func (c *Compatible) chatPath() string {
+	if c.Config.ChatPath != "" {
+		return c.Config.ChatPath
+	}
+	return "/v1/chat/completions"
+}
+
+// openAi returns the config of the OpenAI API itself, it is created for every
+// request so changes to BaseURL are picked up
+func openAi() *Compatible {
+	store := false
+	return NewCompatible(Config{
+		Name:              "openai",
+		BaseURL:           BaseURL,
+		ApiKey:            apikey.OpenAi,
+		SystemRole:        "developer",
+		MaxTokensField:    MaxCompletionTokensField,
+		Store:             &store,
+		Parts:             []llm.PartType{llm.PartImage, llm.PartAudio, llm.PartFile},
+		StreamUsage:       true,
+		ParallelToolCalls: true,
+		ReasoningEffort:   reasoningEffort,
+		Sampling:          openAiSampling,
+	})
+}
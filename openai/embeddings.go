@@ -0,0 +1,58 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Back-to-code/go-llm"
+)
+
+// Embeddings embeds text with the OpenAI embeddings API, it can be used as the Embedder of a llm.SemanticCache
+type Embeddings struct {
+	Model      string // Defaults to text-embedding-3-small
+	Dimensions int    // Shortens the embedding if set
+}
+
+var _ llm.Embedder = &Embeddings{}
+
+type EmbeddingsRequest struct {
+	Model      string `json:"model"`
+	Input      string `json:"input"`
+	Dimensions int    `json:"dimensions,omitempty"`
+}
+
+func (e *Embeddings) Embed(ctx context.Context, text string) ([]float32, error) {
+	model := e.Model
+	if model == "" {
+		model = "text-embedding-3-small"
+	}
+
+	resp, err := openAi().newRequest("/v1/embeddings", EmbeddingsRequest{Model: model, Input: text, Dimensions: e.Dimensions}, 0, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send embeddings request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fullResponse, _ := io.ReadAll(resp.Body)
+		return nil, llm.NewAPIError("openai", resp, fullResponse)
+	}
+
+	respContent := struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&respContent)
+	if err != nil {
+		return nil, fmt.Errorf("decoding response: %s", err.Error())
+	}
+	if len(respContent.Data) == 0 {
+		return nil, errors.New("no embeddings")
+	}
+	return respContent.Data[0].Embedding, nil
+}
@@ -0,0 +1,41 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestEmbed(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	var gotReq EmbeddingsRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&gotReq)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[{"embedding":[0.1,0.2,0.3]}]}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	vector, err := (&Embeddings{}).Embed(context.Background(), "how do I reset my password?")
+	if err != nil {
+		t.Fatalf("Embed returned error: %v", err)
+	}
+	if len(vector) != 3 || vector[2] != 0.3 {
+		t.Errorf("unexpected vector %v", vector)
+	}
+	if gotReq.Model != "text-embedding-3-small" || gotReq.Input != "how do I reset my password?" {
+		t.Errorf("unexpected request %+v", gotReq)
+	}
+}
@@ -2,6 +2,7 @@ package openai
 
 import (
 	"bufio"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,10 +11,34 @@ import (
 	"strings"
 
 	"github.com/Back-to-code/go-llm"
-	"github.com/Back-to-code/go-llm/log"
 )
 
-func toMessage(s llm.Message) Message {
+func (c *Compatible) toMessage(s llm.Message) (Message, error) {
+	role := s.Role
+	if s.Role == "system" && c.Config.SystemRole != "" {
+		role = c.Config.SystemRole
+	}
+
+	message := Message{
+		Role:       role,
+		ToolCallId: s.ToolCallId,
+	}
+	for _, toolCall := range s.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, ToolCall{
+			Id:   toolCall.Id,
+			Type: "function",
+			Function: &ToolCallFunction{
+				Name:      toolCall.Name,
+				Arguments: toolCall.Arguments,
+			},
+		})
+	}
+
+	if c.Config.StringContent && len(s.Parts) == 0 {
+		message.Content = s.Content
+		return message, nil
+	}
+
 	content := []MessageContent{}
 	if s.Content != "" {
 		content = append(content, MessageContent{
@@ -21,94 +46,247 @@ func toMessage(s llm.Message) Message {
 			Text: s.Content,
 		})
 	}
-
-	role := s.Role
-	if s.Role == "system" {
-		role = "developer"
+	for _, part := range s.Parts {
+		partContent, err := toMessageContent(part)
+		if err != nil {
+			return message, err
+		}
+		content = append(content, partContent)
 	}
+	message.Content = content
 
-	return Message{
-		Role:       role,
-		Content:    content,
-		ToolCalls:  s.ToolCalls,
-		ToolCallId: s.ToolCallId,
+	return message, nil
+}
+
+func toMessageContent(part llm.Part) (MessageContent, error) {
+	switch part.Type {
+	case llm.PartText:
+		return MessageContent{Type: "text", Text: part.Text}, nil
+	case llm.PartImage:
+		url := part.URL
+		if len(part.Data) > 0 {
+			url = part.DataURL()
+		}
+		return MessageContent{Type: "image_url", ImageUrl: &ImageUrl{Url: url}}, nil
+	case llm.PartAudio:
+		if len(part.Data) == 0 {
+			return MessageContent{}, errors.New("audio can only be send as data")
+		}
+		format, ok := audioFormats[part.MimeType]
+		if !ok {
+			return MessageContent{}, errors.New("unsupported audio type " + part.MimeType)
+		}
+		return MessageContent{Type: "input_audio", InputAudio: &InputAudio{
+			Data:   base64.StdEncoding.EncodeToString(part.Data),
+			Format: format,
+		}}, nil
+	case llm.PartFile:
+		if len(part.Data) == 0 {
+			return MessageContent{}, errors.New("files can only be send as data")
+		}
+		name := part.Name
+		if name == "" {
+			name = "file"
+		}
+		return MessageContent{Type: "file", File: &File{Filename: name, FileData: part.DataURL()}}, nil
 	}
+	return MessageContent{}, errors.New("unsupported part type " + string(part.Type))
+}
+
+var audioFormats = map[string]string{
+	"audio/wav":   "wav",
+	"audio/x-wav": "wav",
+	"audio/wave":  "wav",
+	"audio/mpeg":  "mp3",
+	"audio/mp3":   "mp3",
 }
 
 type Message struct {
-	Role       string           `json:"role"`
-	Content    []MessageContent `json:"content"`
-	ToolCalls  json.RawMessage  `json:"tool_calls,omitempty"`
-	ToolCallId string           `json:"tool_call_id,omitempty"`
+	Role       string     `json:"role"`
+	Content    any        `json:"content"` // A string or a list of MessageContent
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallId string     `json:"tool_call_id,omitempty"`
 }
 
 type MessageContent struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type       string      `json:"type"` // "text", "image_url", "input_audio" or "file"
+	Text       string      `json:"text,omitempty"`
+	ImageUrl   *ImageUrl   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+	File       *File       `json:"file,omitempty"`
+}
+
+type ImageUrl struct {
+	Url string `json:"url"` // A http(s) or base64 data url
+}
+
+type InputAudio struct {
+	Data   string `json:"data"` // Base64 encoded
+	Format string `json:"format"`
+}
+
+type File struct {
+	Filename string `json:"filename"`
+	FileData string `json:"file_data"` // A base64 data url
+}
+
+type ToolCall struct {
+	Id       string            `json:"id"`
+	Type     string            `json:"type"`
+	Function *ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 type ResponseFormat struct {
-	Type string `json:"type"`
+	Type       string          `json:"type"`
+	JsonSchema *llm.JsonSchema `json:"json_schema,omitempty"`
 }
 
 type InferenceRequest struct {
-	Model               string         `json:"model"`
-	Messages            []Message      `json:"messages"`
-	MaxCompletionTokens int            `json:"max_completion_tokens,omitempty"`
-	ResponseFormat      ResponseFormat `json:"response_format"`
-	Stream              bool           `json:"stream"`
-	Store               bool           `json:"store"`
-	Tools               []llm.Tool     `json:"tools"`
-	ToolChoice          string         `json:"tool_choice,omitempty"`
-	ReasoningEffort     string         `json:"reasoning_effort,omitempty"`
+	Model               string          `json:"model"`
+	Messages            []Message       `json:"messages"`
+	MaxTokens           int             `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"`
+	ResponseFormat      *ResponseFormat `json:"response_format,omitempty"`
+	Stream              bool            `json:"stream"`
+	Store               *bool           `json:"store,omitempty"`
+	Tools               []llm.Tool      `json:"tools,omitempty"`
+	ToolChoice          any             `json:"tool_choice,omitempty"` // A mode like "auto" or a NamedToolChoice
+	ParallelToolCalls   *bool           `json:"parallel_tool_calls,omitempty"`
+	ReasoningEffort     string          `json:"reasoning_effort,omitempty"`
+	Reasoning           any             `json:"reasoning,omitempty"`
+	StreamOptions       *StreamOptions  `json:"stream_options,omitempty"`
+	Sampling
+}
+
+// Sampling contains the optional sampling parameters of a request
+type Sampling struct {
+	Temperature      *float64       `json:"temperature,omitempty"`
+	TopP             *float64       `json:"top_p,omitempty"`
+	Seed             *int           `json:"seed,omitempty"`
+	Stop             []string       `json:"stop,omitempty"`
+	PresencePenalty  *float64       `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64       `json:"frequency_penalty,omitempty"`
+	LogitBias        map[string]int `json:"logit_bias,omitempty"`
 }
 
-func createRequest(stream bool, model string, messages []llm.Message, options llm.Options) (io.ReadCloser, error) {
+func toSampling(options llm.Options) Sampling {
+	return Sampling{
+		Temperature:      options.Temperature,
+		TopP:             options.TopP,
+		Seed:             options.Seed,
+		Stop:             options.StopSequences,
+		PresencePenalty:  options.PresencePenalty,
+		FrequencyPenalty: options.FrequencyPenalty,
+		LogitBias:        options.LogitBias,
+	}
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type Usage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	CachedTokens        int `json:"cached_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+// toTokenUsage converts the usage, some APIs (like Together AI) report cached
+// tokens at the top level instead of in prompt_tokens_details.
+func (u Usage) toTokenUsage() llm.TokenUsage {
+	cachedTokens := u.PromptTokensDetails.CachedTokens
+	if cachedTokens == 0 {
+		cachedTokens = u.CachedTokens
+	}
+	return llm.TokenUsage{
+		InputTokens:       u.PromptTokens,
+		OutputTokens:      u.CompletionTokens,
+		CachedInputTokens: cachedTokens,
+	}
+}
+
+func (c *Compatible) createRequest(stream bool, model string, messages []llm.Message, options llm.Options) (io.ReadCloser, error) {
 	bodyMessages := make([]Message, len(messages))
 	for idx, msg := range messages {
-		bodyMessages[idx] = toMessage(msg)
+		message, err := c.toMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		bodyMessages[idx] = message
 	}
 
-	responseFormat := "text"
-	if options.ResponseFormat != "" {
-		responseFormat = string(options.ResponseFormat)
+	reqBody := InferenceRequest{
+		Stream:   stream,
+		Model:    model,
+		Messages: bodyMessages,
+		Store:    c.Config.Store,
+		Tools:    options.Tools,
 	}
 
-	reqBody := InferenceRequest{
-		Stream:         stream,
-		Model:          model,
-		Messages:       bodyMessages,
-		ResponseFormat: ResponseFormat{responseFormat},
-		Store:          false,
-		Tools:          options.Tools,
+	if options.ResponseFormat != "" {
+		reqBody.ResponseFormat = &ResponseFormat{Type: string(options.ResponseFormat)}
+	}
+	if options.ResponseFormat == llm.ResponseFormatJsonSchema {
+		reqBody.ResponseFormat.JsonSchema = options.JsonSchema
 	}
 
 	if len(options.Tools) > 0 {
-		reqBody.ToolChoice = "auto"
+		reqBody.ToolChoice = toToolChoice(options.ToolChoice)
+		if c.Config.ParallelToolCalls {
+			reqBody.ParallelToolCalls = options.ParallelToolCalls
+		}
+	}
+	if len(options.Tools) == 0 || c.Config.ReasoningWithTools {
+		if c.Config.ReasoningEffort != nil {
+			reqBody.ReasoningEffort = c.Config.ReasoningEffort(model, options.Thinking)
+		}
+		if c.Config.Reasoning != nil {
+			reqBody.Reasoning = c.Config.Reasoning(model, options.Thinking)
+		}
+	}
+
+	maxTokens := options.MaxTokens
+	if c.Config.MaxTokensCeiling > 0 {
+		maxTokens = min(maxTokens, c.Config.MaxTokensCeiling)
+	}
+	if c.Config.MaxTokensField == MaxCompletionTokensField {
+		reqBody.MaxCompletionTokens = maxTokens
 	} else {
-		reqBody.ReasoningEffort = reasoningEffort(model, options.Thinking)
+		reqBody.MaxTokens = maxTokens
+	}
+
+	reqBody.Sampling = toSampling(options)
+	if c.Config.Sampling != nil {
+		reqBody.Sampling = c.Config.Sampling(model, options.Thinking, reqBody.Sampling)
 	}
 
-	reqBody.MaxCompletionTokens = options.MaxTokens
+	if stream && c.Config.StreamUsage {
+		reqBody.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
 
-	resp, err := newRequest("/v1/chat/completions", reqBody, options.Timeout, options.Ctx)
+	resp, err := c.newRequest(c.chatPath(), reqBody, options.Timeout, options.Ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send completions request: %s", err.Error())
+		return nil, fmt.Errorf("failed to send completions request: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		fullResponse, err := io.ReadAll(resp.Body)
+		fullResponse, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		if err != nil {
-			return nil, fmt.Errorf("API request failed with status %d", resp.StatusCode)
-		}
-
-		return nil, errors.New(string(fullResponse))
+		return nil, llm.NewAPIError(c.name(), resp, fullResponse)
 	}
 
 	return resp.Body, nil
 }
 
+// Provider talks to the OpenAI API, use Compatible for other APIs that follow the same spec
 type Provider struct{}
 
 var _ llm.Provider = &Provider{}
@@ -117,6 +295,10 @@ func (*Provider) SupportsStructuredOutput() bool {
 	return true
 }
 
+func (*Provider) SupportsJsonSchema() bool {
+	return true
+}
+
 func (*Provider) SupportsStreaming() bool {
 	return true
 }
@@ -125,208 +307,215 @@ func (*Provider) SupportsTools() bool {
 	return true
 }
 
-func (p *Provider) Prompt(model string, messages []llm.Message, options llm.Options) (llm.Response, error) {
-	resp, err := createRequest(false, model, messages, options)
+func (*Provider) SupportsPart(partType llm.PartType) bool {
+	return openAi().SupportsPart(partType)
+}
+
+func (*Provider) Prompt(model string, messages []llm.Message, options llm.Options) (llm.Response, error) {
+	return openAi().Prompt(model, messages, options)
+}
+
+func (*Provider) StreamEvents(model string, messages []llm.Message, options llm.Options) (chan llm.StreamEvent, error) {
+	return openAi().StreamEvents(model, messages, options)
+}
+
+func (c *Compatible) Prompt(model string, messages []llm.Message, options llm.Options) (llm.Response, error) {
+	return llm.ToolLoop{
+		Options: options,
+		Round: func(messages []llm.Message, options llm.Options) (llm.RoundResult, error) {
+			return c.promptRound(model, messages, options)
+		},
+	}.Run(messages)
+}
+
+// promptRound sends a single request, the tool calls in the answer are resolved by the llm.ToolLoop
+func (c *Compatible) promptRound(model string, messages []llm.Message, options llm.Options) (llm.RoundResult, error) {
+	resp, err := c.createRequest(false, model, messages, options)
 	if err != nil {
-		return llm.Response{}, err
+		return llm.RoundResult{}, err
 	}
 	defer resp.Close()
 
 	respContent := struct {
 		Choices []struct {
-			Message json.RawMessage `json:"message"`
+			Message      json.RawMessage `json:"message"`
+			FinishReason string          `json:"finish_reason"`
 		} `json:"choices"`
-		Usage struct {
-			PromptTokens        int `json:"prompt_tokens"`
-			CompletionTokens    int `json:"completion_tokens"`
-			PromptTokensDetails struct {
-				CachedTokens int `json:"cached_tokens"`
-			} `json:"prompt_tokens_details"`
-		} `json:"usage"`
+		Usage Usage `json:"usage"`
 	}{}
 	err = json.NewDecoder(resp).Decode(&respContent)
 	if err != nil {
-		return llm.Response{}, err
+		return llm.RoundResult{}, err
 	}
 	if len(respContent.Choices) == 0 {
-		return llm.Response{}, errors.New("no responses")
-	}
-
-	currentUsage := llm.TokenUsage{
-		InputTokens:       respContent.Usage.PromptTokens,
-		OutputTokens:      respContent.Usage.CompletionTokens,
-		CachedInputTokens: respContent.Usage.PromptTokensDetails.CachedTokens,
+		return llm.RoundResult{}, errors.New("no responses")
 	}
 
-	rawLastMessage := respContent.Choices[len(respContent.Choices)-1].Message
+	lastChoice := respContent.Choices[len(respContent.Choices)-1]
 	var lastMessage struct {
-		Content   *string `json:"content"`
-		ToolCalls []struct {
-			Id       string `json:"id"`
-			Type     string `json:"type"`
-			Function *struct {
-				Name      string `json:"name"`
-				Arguments string `json:"arguments"`
-			} `json:"function"`
-		} `json:"tool_calls"`
-	}
-	err = json.Unmarshal(rawLastMessage, &lastMessage)
+		Content   *string    `json:"content"`
+		ToolCalls []ToolCall `json:"tool_calls"`
+	}
+	err = json.Unmarshal(lastChoice.Message, &lastMessage)
 	if err != nil {
-		return llm.Response{}, fmt.Errorf("failed to unmarshal response: %s", err.Error())
+		return llm.RoundResult{}, fmt.Errorf("failed to unmarshal response: %s", err.Error())
 	}
 
+	result := llm.RoundResult{
+		Message:      llm.Message{Role: "assistant"},
+		Usage:        respContent.Usage.toTokenUsage(),
+		StopReason:   stopReason(lastChoice.FinishReason),
+		FinishReason: lastChoice.FinishReason,
+	}
 	if len(lastMessage.ToolCalls) > 0 {
-		tools := lastMessage.ToolCalls
-		var jsonTools []byte
-		jsonTools, err = json.Marshal(tools)
-		if err != nil {
-			return llm.Response{}, fmt.Errorf("failed to marshal tools: %s", err.Error())
-		}
-		messages = append(messages, llm.Message{
-			Role:      "assistant",
-			ToolCalls: jsonTools,
-		})
+		result.Message.ToolCalls, err = toToolCalls(lastMessage.ToolCalls)
+		return result, err
+	}
 
-		for _, toolCall := range tools {
-			if toolCall.Type != "function" {
-				return llm.Response{}, errors.New("unsupported tool type " + toolCall.Type)
-			}
-			if toolCall.Function == nil {
-				return llm.Response{}, errors.New("missing function")
-			}
+	if (lastMessage.Content == nil || *lastMessage.Content == "") && lastChoice.FinishReason == "content_filter" {
+		return llm.RoundResult{}, &llm.APIError{Provider: c.name(), Code: lastChoice.FinishReason, Message: "the answer was removed by the content filter"}
+	}
+	if lastMessage.Content == nil {
+		return llm.RoundResult{}, errors.New("missing content")
+	}
 
-			foundTool := false
-			var response any
-			var resolveErr error
-			log.Info("llm tool call " + toolCall.Function.Name)
-			for _, tool := range options.Tools {
-				if toolCall.Function.Name != tool.Function.Name {
-					continue
-				}
-				foundTool = true
-
-				var arguments json.RawMessage
-				if uerr := json.Unmarshal([]byte(toolCall.Function.Arguments), &arguments); uerr != nil {
-					arguments = json.RawMessage("null")
-				}
-
-				response, resolveErr = tool.Resolver(arguments)
-				break
-			}
-			if !foundTool {
-				messages = append(messages, llm.Message{
-					Role:       "tool",
-					Content:    "error: not found",
-					ToolCallId: toolCall.Id,
-				})
-				continue
-			}
+	result.Message.Content = *lastMessage.Content
+	return result, nil
+}
+
+func (c *Compatible) StreamEvents(model string, messages []llm.Message, options llm.Options) (chan llm.StreamEvent, error) {
+	resp, err := c.createRequest(true, model, messages, options)
+	if err != nil {
+		return nil, err
+	}
+
+	open := func(messages []llm.Message, options llm.Options) (io.ReadCloser, error) {
+		return c.createRequest(true, model, messages, options)
+	}
+	return llm.StreamToolLoop(resp, messages, options, open, c.readStream), nil
+}
 
-			if resolveErr != nil {
-				messages = append(messages, llm.Message{
-					Role:       "tool",
-					Content:    "error: " + resolveErr.Error(),
-					ToolCallId: toolCall.Id,
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			Reasoning        string `json:"reasoning"`
+			ReasoningContent string `json:"reasoning_content"`
+			ToolCalls        []struct {
+				Index    int    `json:"index"`
+				Id       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage          `json:"usage"`
+	Error json.RawMessage `json:"error"`
+}
+
+// readStream parses the server sent events of a chat completions stream and
+// forwards them as events until the stream ends
+func (c *Compatible) readStream(resp io.Reader, events chan llm.StreamEvent) (llm.RoundResult, error) {
+	round := llm.RoundResult{Message: llm.Message{Role: "assistant"}}
+	toolCalls := []*llm.StreamToolCall{}
+	finishToolCalls := func() {
+		for _, toolCall := range toolCalls {
+			if toolCall != nil {
+				finished := *toolCall
+				round.Message.ToolCalls = append(round.Message.ToolCalls, llm.ToolCall{
+					Id:        finished.Id,
+					Name:      finished.Name,
+					Arguments: finished.Arguments,
 				})
-				continue
+				events <- llm.StreamEvent{Kind: llm.StreamToolCallFinished, ToolCall: &finished}
 			}
+		}
+		toolCalls = toolCalls[:0]
+	}
 
-			responseJson, err := json.Marshal(response)
-			if err != nil {
-				messages = append(messages, llm.Message{
-					Role:       "tool",
-					Content:    "error: " + err.Error(),
-					ToolCallId: toolCall.Id,
-				})
-				continue
+	reader := bufio.NewReader(resp)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				finishToolCalls()
+				return round, nil
 			}
+			return round, fmt.Errorf("reading stream: %w", err)
+		}
 
-			messages = append(messages, llm.Message{
-				Role:       "tool",
-				Content:    string(responseJson),
-				ToolCallId: toolCall.Id,
-			})
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			finishToolCalls()
+			return round, nil
 		}
 
-		// Recurse to continue the conversation after tool calls.
-		// Accumulate token usage from this round with the inner rounds.
-		innerResp, err := p.Prompt(model, messages, options)
+		chunk := streamChunk{}
+		err = json.Unmarshal([]byte(data), &chunk)
 		if err != nil {
-			return llm.Response{}, err
+			continue
+		}
+		if len(chunk.Error) > 0 && string(chunk.Error) != "null" {
+			return round, llm.NewAPIError(c.name(), nil, chunk.Error)
 		}
-		innerResp.Usage.InputTokens += currentUsage.InputTokens
-		innerResp.Usage.OutputTokens += currentUsage.OutputTokens
-		innerResp.Usage.CachedInputTokens += currentUsage.CachedInputTokens
-		return innerResp, nil
-	}
-
-	if lastMessage.Content == nil {
-		return llm.Response{}, errors.New("missing content")
-	}
-
-	// Append the final assistant message to the conversation.
-	messages = append(messages, llm.Message{
-		Role:    "assistant",
-		Content: *lastMessage.Content,
-	})
-
-	return llm.Response{
-		Value:        *lastMessage.Content,
-		Conversation: messages,
-		Usage:        currentUsage,
-	}, nil
-}
-
-func (*Provider) Stream(model string, messages []llm.Message, options llm.Options) (chan string, error) {
-	resp, err := createRequest(true, model, messages, options)
-	if err != nil {
-		return nil, err
-	}
 
-	linesChannel := make(chan string)
-	go func() {
-		defer func() {
-			resp.Close()
-			close(linesChannel)
-		}()
+		if chunk.Usage != nil {
+			round.Usage = chunk.Usage.toTokenUsage()
+			events <- llm.StreamEvent{Kind: llm.StreamUsage, Usage: round.Usage}
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
 
-		reader := bufio.NewReader(resp)
-		for {
-			line, _, err := reader.ReadLine()
-			if err != nil {
-				break
-			}
+		choice := chunk.Choices[0]
+		if reasoning := choice.Delta.Reasoning + choice.Delta.ReasoningContent; reasoning != "" {
+			events <- llm.StreamEvent{Kind: llm.StreamReasoning, Text: reasoning}
+		}
+		if choice.Delta.Content != "" {
+			round.Message.Content += choice.Delta.Content
+			events <- llm.StreamEvent{Kind: llm.StreamText, Text: choice.Delta.Content}
+		}
 
-			lineStr := string(line)
-			lineStr, ok := strings.CutPrefix(lineStr, "data:")
-			if !ok {
-				continue
+		for _, delta := range choice.Delta.ToolCalls {
+			for len(toolCalls) <= delta.Index {
+				toolCalls = append(toolCalls, nil)
 			}
 
-			lineStr = strings.TrimSpace(lineStr)
-			contentJson := struct {
-				Choices []struct {
-					Delta struct {
-						Content string `json:"content"`
-					} `json:"delta"`
-				} `json:"choices"`
-			}{}
-			err = json.Unmarshal([]byte(lineStr), &contentJson)
-			if err != nil {
-				continue
+			toolCall := toolCalls[delta.Index]
+			if toolCall == nil {
+				toolCall = &llm.StreamToolCall{Index: delta.Index, Id: delta.Id, Name: delta.Function.Name}
+				toolCalls[delta.Index] = toolCall
+				events <- llm.StreamEvent{Kind: llm.StreamToolCallStarted, ToolCall: &llm.StreamToolCall{
+					Index: toolCall.Index,
+					Id:    toolCall.Id,
+					Name:  toolCall.Name,
+				}}
 			}
-			if len(contentJson.Choices) == 0 {
-				continue
+			if delta.Function.Arguments != "" {
+				toolCall.Arguments += delta.Function.Arguments
+				events <- llm.StreamEvent{Kind: llm.StreamToolCallArgument, ToolCall: &llm.StreamToolCall{
+					Index:     toolCall.Index,
+					Id:        toolCall.Id,
+					Name:      toolCall.Name,
+					Arguments: delta.Function.Arguments,
+				}}
 			}
+		}
 
-			delta := contentJson.Choices[0].Delta.Content
-			if delta == "" {
-				continue
-			}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			finishToolCalls()
 
-			linesChannel <- delta
+			round.FinishReason = *choice.FinishReason
+			round.StopReason = stopReason(round.FinishReason)
+			events <- llm.StreamEvent{Kind: llm.StreamFinish, FinishReason: round.FinishReason, StopReason: round.StopReason}
 		}
-	}()
-
-	return linesChannel, nil
+	}
 }
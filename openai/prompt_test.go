@@ -1,12 +1,16 @@
 package openai
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	llm "github.com/Back-to-code/go-llm"
 )
@@ -95,3 +99,544 @@ func TestPromptToolResolverThreadsArgsAndErrors(t *testing.T) {
 		t.Fatalf("wrong args threaded to resolver: got %q", gotArgs)
 	}
 }
+
+// Test that a json schema response format is sent in the shape OpenAI expects.
+func TestPromptJsonSchemaResponseFormat(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	var gotFormat struct {
+		Type       string `json:"type"`
+		JsonSchema struct {
+			Name   string          `json:"name"`
+			Schema json.RawMessage `json:"schema"`
+			Strict bool            `json:"strict"`
+		} `json:"json_schema"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResponseFormat json.RawMessage `json:"response_format"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.Unmarshal(req.ResponseFormat, &gotFormat)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"{\"color\":\"blue\"}"}}]}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	model := &llm.Model{Name: "gpt-test", Provider: &Provider{}}
+	_, err := model.PromptSingle("color?", llm.Options{
+		Retry: llm.NoRetry,
+		JsonSchema: &llm.JsonSchema{
+			Schema: json.RawMessage(`{"type":"object","properties":{"color":{"type":"string"}},"required":["color"],"additionalProperties":false}`),
+			Strict: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if gotFormat.Type != "json_schema" {
+		t.Fatalf("response_format.type = %q, want json_schema", gotFormat.Type)
+	}
+	if gotFormat.JsonSchema.Name != "response" {
+		t.Fatalf("json_schema.name = %q, want default name", gotFormat.JsonSchema.Name)
+	}
+	if !gotFormat.JsonSchema.Strict || len(gotFormat.JsonSchema.Schema) == 0 {
+		t.Fatalf("json_schema not forwarded: %+v", gotFormat.JsonSchema)
+	}
+}
+
+// Test that the chat completions stream is translated into typed events and
+// that an error in the middle of the stream is reported instead of silently
+// closing the channel.
+func TestStreamEvents(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(strings.Join([]string{
+			`data: {"choices":[{"delta":{"role":"assistant","content":"Hel"}}]}`,
+			`data: {"choices":[{"delta":{"content":"lo"}}]}`,
+			`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"lookup","arguments":""}}]}}]}`,
+			`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"q\":"}}]}}]}`,
+			`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]}}]}`,
+			`data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+			`data: {"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3}}`,
+			`data: {"error":{"message":"overloaded"}}`,
+			``,
+		}, "\n\n")))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	p := &Provider{}
+	events, err := p.StreamEvents("gpt-test", []llm.Message{llm.User("hi")}, llm.Options{})
+	if err != nil {
+		t.Fatalf("StreamEvents returned error: %v", err)
+	}
+
+	var text string
+	var finished *llm.StreamToolCall
+	var usage llm.TokenUsage
+	var finishReason string
+	var streamErr error
+	for event := range events {
+		switch event.Kind {
+		case llm.StreamText:
+			text += event.Text
+		case llm.StreamToolCallFinished:
+			finished = event.ToolCall
+		case llm.StreamUsage:
+			usage = event.Usage
+		case llm.StreamFinish:
+			finishReason = event.FinishReason
+		case llm.StreamError:
+			streamErr = event.Err
+		}
+	}
+
+	if text != "Hello" {
+		t.Errorf("text = %q, want %q", text, "Hello")
+	}
+	if finished == nil || finished.Id != "call_1" || finished.Name != "lookup" || finished.Arguments != `{"q":1}` {
+		t.Errorf("unexpected finished tool call %+v", finished)
+	}
+	if usage.InputTokens != 7 || usage.OutputTokens != 3 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	if finishReason != "tool_calls" {
+		t.Errorf("finish reason = %q", finishReason)
+	}
+	if streamErr == nil || !strings.Contains(streamErr.Error(), "overloaded") {
+		t.Errorf("expected mid-stream error, got %v", streamErr)
+	}
+}
+
+// Test that a streamed tool call is resolved and the answer that follows is
+// streamed on the same channel.
+func TestStreamEventsResolvesToolCalls(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	var callCount int
+	var followUp struct {
+		Messages []Message `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		w.Header().Set("Content-Type", "text/event-stream")
+		if callCount == 1 {
+			w.Write([]byte(strings.Join([]string{
+				`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{\"q\":"}}]}}]}`,
+				`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]}}]}`,
+				`data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+				`data: [DONE]`,
+				``,
+			}, "\n\n")))
+			return
+		}
+
+		json.NewDecoder(r.Body).Decode(&followUp)
+		w.Write([]byte(strings.Join([]string{
+			`data: {"choices":[{"delta":{"content":"found "}}]}`,
+			`data: {"choices":[{"delta":{"content":"it"},"finish_reason":"stop"}]}`,
+			`data: [DONE]`,
+			``,
+		}, "\n\n")))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	var gotArgs string
+	tools := []llm.Tool{{
+		Type:     "function",
+		Function: llm.FunctionDef{Name: "lookup"},
+		Resolver: func(args json.RawMessage) (any, error) {
+			gotArgs = string(args)
+			return "result", nil
+		},
+	}}
+
+	messages := []llm.Message{llm.User("hi")}
+	p := &Provider{}
+	events, err := p.StreamEvents("gpt-test", messages, llm.Options{Tools: tools})
+	if err != nil {
+		t.Fatalf("StreamEvents returned error: %v", err)
+	}
+	resp, err := llm.CollectStream(messages, events)
+	if err != nil {
+		t.Fatalf("stream reported error: %v", err)
+	}
+
+	if gotArgs != `{"q":1}` {
+		t.Errorf("wrong args threaded to resolver: %q", gotArgs)
+	}
+	if resp.Value != "found it" {
+		t.Errorf("Value = %q, want %q", resp.Value, "found it")
+	}
+	if len(resp.Conversation) != 4 {
+		t.Fatalf("expected user, tool call, tool result and answer in conversation, got %d messages", len(resp.Conversation))
+	}
+	if resp.Conversation[2].Role != "tool" || resp.Conversation[2].ToolCallId != "call_1" {
+		t.Errorf("unexpected tool message %+v", resp.Conversation[2])
+	}
+	if len(followUp.Messages) != 3 || followUp.Messages[2].ToolCallId != "call_1" {
+		t.Errorf("follow-up request did not contain the tool result: %+v", followUp.Messages)
+	}
+}
+
+// Test a compatible API gets the configured path, headers and request quirks.
+func TestCompatibleConfig(t *testing.T) {
+	var gotReq map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/gpt/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Api-Key") != "azure-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("expected the key as is in the api-key header, got %v", r.Header)
+		}
+		if r.Header.Get("X-Title") != "go-llm" {
+			t.Errorf("missing extra header")
+		}
+		json.NewDecoder(r.Body).Decode(&gotReq)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer server.Close()
+
+	p := NewCompatible(Config{
+		BaseURL:       server.URL + "/",
+		ChatPath:      "/openai/deployments/gpt/chat/completions",
+		ApiKey:        func() (string, error) { return "azure-key", nil },
+		AuthHeader:    "api-key",
+		Headers:       map[string]string{"X-Title": "go-llm"},
+		StringContent: true,
+	})
+	resp, err := p.Prompt("gpt", []llm.Message{llm.System("be brief"), llm.User("hi")}, llm.Options{MaxTokens: 10})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if resp.Value != "hi" {
+		t.Errorf("Value = %q", resp.Value)
+	}
+
+	messages := gotReq["messages"].([]any)
+	system := messages[0].(map[string]any)
+	if system["role"] != "system" || system["content"] != "be brief" {
+		t.Errorf("unexpected system message %v", system)
+	}
+	if gotReq["max_tokens"] != float64(10) || gotReq["max_completion_tokens"] != nil {
+		t.Errorf("expected max_tokens, got %v", gotReq)
+	}
+	if _, ok := gotReq["store"]; ok {
+		t.Errorf("store should be omitted")
+	}
+}
+
+// Test images, audio and files are send as content parts.
+func TestPromptContentParts(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	var gotReq struct {
+		Messages []struct {
+			Content []MessageContent `json:"content"`
+		} `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&gotReq)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"an invoice"}}]}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	message := llm.UserWithParts("what is this?",
+		llm.ImagePart([]byte("png"), "image/png"),
+		llm.AudioPart([]byte("wav"), "audio/wav"),
+		llm.FilePart("invoice.pdf", []byte("pdf"), "application/pdf"),
+	)
+	_, err := (&Provider{}).Prompt("gpt-test", []llm.Message{message}, llm.Options{})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+
+	content := gotReq.Messages[0].Content
+	if len(content) != 4 || content[0].Text != "what is this?" {
+		t.Fatalf("unexpected content %+v", content)
+	}
+	if content[1].Type != "image_url" || content[1].ImageUrl.Url != "data:image/png;base64,cG5n" {
+		t.Errorf("unexpected image %+v", content[1])
+	}
+	if content[2].Type != "input_audio" || content[2].InputAudio.Format != "wav" || content[2].InputAudio.Data != "d2F2" {
+		t.Errorf("unexpected audio %+v", content[2])
+	}
+	if content[3].Type != "file" || content[3].File.Filename != "invoice.pdf" || content[3].File.FileData != "data:application/pdf;base64,cGRm" {
+		t.Errorf("unexpected file %+v", content[3])
+	}
+}
+
+// Test sampling parameters are send, but dropped for reasoning models that reject them.
+func TestPromptSampling(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	var gotReq map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotReq = nil
+		json.NewDecoder(r.Body).Decode(&gotReq)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	options := llm.Options{
+		Temperature:   llm.Ptr(0.0),
+		TopP:          llm.Ptr(0.5),
+		Seed:          llm.Ptr(42),
+		StopSequences: []string{"END"},
+		LogitBias:     map[string]int{"50256": -100},
+	}
+
+	_, err := (&Provider{}).Prompt("gpt-4.1", []llm.Message{llm.User("hi")}, options)
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if gotReq["temperature"] != 0.0 || gotReq["top_p"] != 0.5 || gotReq["seed"] != 42.0 || gotReq["stop"] == nil || gotReq["logit_bias"] == nil {
+		t.Errorf("expected all sampling parameters, got %v", gotReq)
+	}
+
+	_, err = (&Provider{}).Prompt("o4-mini", []llm.Message{llm.User("hi")}, options)
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if _, ok := gotReq["temperature"]; ok || gotReq["top_p"] != nil || gotReq["stop"] != nil || gotReq["seed"] != 42.0 {
+		t.Errorf("expected only the seed for a reasoning model, got %v", gotReq)
+	}
+}
+
+// Test a non-200 response is returned as a classified llm.APIError.
+func TestPromptRateLimited(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After-Ms", "1500")
+		w.Header().Set("X-Request-Id", "req_123")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	_, err := (&Provider{}).Prompt("gpt-test", []llm.Message{llm.User("hi")}, llm.Options{})
+	if !errors.Is(err, llm.ErrRateLimited) {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+	var apiErr *llm.APIError
+	errors.As(err, &apiErr)
+	if apiErr.Provider != "openai" || apiErr.RequestId != "req_123" || apiErr.RetryAfter != 1500*time.Millisecond {
+		t.Errorf("unexpected error details %+v", apiErr)
+	}
+}
+
+// Test a model that keeps calling tools is stopped after MaxToolRounds.
+func TestPromptMaxToolRounds(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"again","arguments":"{}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":5,"completion_tokens":1}}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	tools := []llm.Tool{{
+		Type:     "function",
+		Function: llm.FunctionDef{Name: "again"},
+		Resolver: func(json.RawMessage) (any, error) { return "call me again", nil },
+	}}
+	resp, err := (&Provider{}).Prompt("gpt-test", []llm.Message{llm.User("hi")}, llm.Options{Tools: tools, MaxToolRounds: 2})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if requests != 3 || resp.StopReason != llm.StopMaxToolRounds {
+		t.Errorf("expected to stop after 3 requests, got %d requests and stop reason %q", requests, resp.StopReason)
+	}
+	if len(resp.Rounds) != 3 || resp.Rounds[0].FinishReason != "tool_calls" || resp.Usage.InputTokens != 15 {
+		t.Errorf("unexpected rounds %+v and usage %+v", resp.Rounds, resp.Usage)
+	}
+}
+
+// Test an answer cut off at the token limit reports the max tokens stop reason.
+func TestPromptStopReasonMaxTokens(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"cut o"},"finish_reason":"length"}]}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	resp, err := (&Provider{}).Prompt("gpt-test", []llm.Message{llm.User("hi")}, llm.Options{MaxTokens: 2})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if resp.StopReason != llm.StopMaxTokens {
+		t.Errorf("expected stop reason %q, got %q", llm.StopMaxTokens, resp.StopReason)
+	}
+}
+
+// Test the tool choice is send as tool_choice, a named function as an object,
+// and parallel_tool_calls is only send when set and the API accepts it.
+func TestPromptToolChoice(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	var gotChoice, gotParallel any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		gotChoice = req["tool_choice"]
+		gotParallel = req["parallel_tool_calls"]
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"done"}}]}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	tools := []llm.Tool{{
+		Function: llm.FunctionDef{Name: "extract"},
+		Resolver: func(json.RawMessage) (any, error) { return nil, nil },
+	}}
+	for _, test := range []struct {
+		choice llm.ToolChoice
+		want   string
+	}{
+		{llm.ToolChoice{}, `"auto"`},
+		{llm.ToolChoice{Mode: llm.ToolChoiceNone}, `"none"`},
+		{llm.ToolChoice{Mode: llm.ToolChoiceRequired}, `"required"`},
+		{llm.CallTool("extract"), `{"function":{"name":"extract"},"type":"function"}`},
+	} {
+		_, err := (&Provider{}).Prompt("gpt-test", []llm.Message{llm.User("hi")}, llm.Options{Tools: tools, ToolChoice: test.choice})
+		if err != nil {
+			t.Fatalf("Prompt returned error: %v", err)
+		}
+		got, _ := json.Marshal(gotChoice)
+		if string(got) != test.want {
+			t.Errorf("expected tool_choice %s, got %s", test.want, got)
+		}
+		if gotParallel != nil {
+			t.Errorf("expected parallel_tool_calls to be left out, got %v", gotParallel)
+		}
+	}
+
+	_, err := (&Provider{}).Prompt("gpt-test", []llm.Message{llm.User("hi")}, llm.Options{Tools: tools, ParallelToolCalls: llm.Ptr(false)})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if gotParallel != false {
+		t.Errorf("expected parallel_tool_calls false, got %v", gotParallel)
+	}
+
+	compatible := NewCompatible(Config{BaseURL: server.URL})
+	_, err = compatible.Prompt("llama-test", []llm.Message{llm.User("hi")}, llm.Options{Tools: tools, ParallelToolCalls: llm.Ptr(false)})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if gotParallel != nil {
+		t.Errorf("expected parallel_tool_calls to be left out for other APIs, got %v", gotParallel)
+	}
+}
+
+// Test tools are send in the chat completions format, with strict inside the function object.
+func TestPromptToolDefinition(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	var gotTools json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Tools json.RawMessage `json:"tools"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		gotTools = req.Tools
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"done"}}]}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	tool := llm.MustNewTool("lookup", "Looks up a word", func(ctx context.Context, args struct {
+		Word string `json:"word"`
+	}) (string, error) {
+		return "", nil
+	})
+	_, err := (&Provider{}).Prompt("gpt-test", []llm.Message{llm.User("hi")}, llm.Options{Tools: []llm.Tool{tool}})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+
+	want := `[{"type":"function","function":{"name":"lookup","description":"Looks up a word","parameters":{"type":"object","properties":{"word":{"type":"string"}},"required":["word"],"additionalProperties":false},"strict":true}}]`
+	if string(gotTools) != want {
+		t.Errorf("unexpected tools\nwant %s\ngot  %s", want, gotTools)
+	}
+
+	// The deprecated Tool.Strict still turns on strict mode
+	oldTool := llm.Tool{
+		Function: llm.FunctionDef{Name: "lookup", AdditionalProperties: true},
+		Strict:   true,
+		Resolver: func(json.RawMessage) (any, error) { return nil, nil },
+	}
+	model := &llm.Model{Name: "gpt-test", Provider: &Provider{}}
+	_, err = model.Prompt([]llm.Message{llm.User("hi")}, llm.Options{Tools: []llm.Tool{oldTool}})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	want = `[{"type":"function","function":{"name":"lookup","strict":true}}]`
+	if string(gotTools) != want {
+		t.Errorf("unexpected tools\nwant %s\ngot  %s", want, gotTools)
+	}
+}
@@ -75,3 +75,21 @@ func reasoningEffort(model string, thinking llm.Thinking) string {
 
 	return ""
 }
+
+// isReasoningModel reports if the model always reasons, these models reject most sampling parameters
+func isReasoningModel(model string) bool {
+	model = strings.ToLower(model)
+	if strings.HasPrefix(model, "gpt-5") {
+		return !strings.Contains(model, "chat")
+	}
+	return len(model) > 1 && model[0] == 'o' && model[1] >= '0' && model[1] <= '9'
+}
+
+// openAiSampling drops the sampling parameters reasoning models reject, newer
+// models accept them again when reasoning is disabled.
+func openAiSampling(model string, thinking llm.Thinking, sampling Sampling) Sampling {
+	if !isReasoningModel(model) || reasoningEffort(model, thinking) == "none" {
+		return sampling
+	}
+	return Sampling{Seed: sampling.Seed}
+}
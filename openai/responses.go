@@ -0,0 +1,599 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Back-to-code/go-llm"
+)
+
+// Responses talks to the OpenAI responses API (/v1/responses), the successor of
+// chat completions with reasoning summaries, built-in tools and stored responses.
+type Responses struct {
+	// Store keeps the responses at OpenAI so they can be continued using
+	// Options.PreviousResponseId. If false the reasoning is returned encrypted
+	// and carried across turns in llm.Message.Reasoning instead.
+	Store bool
+}
+
+var _ llm.Provider = &Responses{}
+var _ llm.BuiltinToolsProvider = &Responses{}
+
+type ResponsesInputMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"` // A string or a list of ResponsesInputContent
+}
+
+type ResponsesInputContent struct {
+	Type     string `json:"type"` // "input_text", "input_image" or "input_file"
+	Text     string `json:"text,omitempty"`
+	ImageUrl string `json:"image_url,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	FileUrl  string `json:"file_url,omitempty"`
+}
+
+type ResponsesFunctionCall struct {
+	Type      string `json:"type"` // "function_call"
+	CallId    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type ResponsesFunctionCallOutput struct {
+	Type   string `json:"type"` // "function_call_output"
+	CallId string `json:"call_id"`
+	Output string `json:"output"`
+}
+
+type ResponsesTextFormat struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+type ResponsesText struct {
+	Format ResponsesTextFormat `json:"format"`
+}
+
+type ResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type ResponsesRequest struct {
+	Model              string              `json:"model"`
+	Input              []any               `json:"input"`
+	Store              bool                `json:"store"`
+	Stream             bool                `json:"stream,omitempty"`
+	Include            []string            `json:"include,omitempty"`
+	Tools              []map[string]any    `json:"tools,omitempty"`
+	ToolChoice         any                 `json:"tool_choice,omitempty"` // A mode like "auto" or a ResponsesToolChoice
+	ParallelToolCalls  *bool               `json:"parallel_tool_calls,omitempty"`
+	Reasoning          *ResponsesReasoning `json:"reasoning,omitempty"`
+	Text               *ResponsesText      `json:"text,omitempty"`
+	MaxOutputTokens    int                 `json:"max_output_tokens,omitempty"`
+	PreviousResponseId string              `json:"previous_response_id,omitempty"`
+	Temperature        *float64            `json:"temperature,omitempty"`
+	TopP               *float64            `json:"top_p,omitempty"`
+}
+
+type ResponsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+}
+
+func (u ResponsesUsage) toTokenUsage() llm.TokenUsage {
+	return llm.TokenUsage{
+		InputTokens:       u.InputTokens,
+		OutputTokens:      u.OutputTokens,
+		CachedInputTokens: u.InputTokensDetails.CachedTokens,
+	}
+}
+
+type ResponsesResponse struct {
+	Id                string            `json:"id"`
+	Status            string            `json:"status"`
+	Output            []json.RawMessage `json:"output"`
+	Usage             ResponsesUsage    `json:"usage"`
+	Error             json.RawMessage   `json:"error"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+}
+
+// finishReason returns the status, or the reason a response is incomplete
+func (r ResponsesResponse) finishReason() string {
+	if r.IncompleteDetails != nil && r.IncompleteDetails.Reason != "" {
+		return r.IncompleteDetails.Reason
+	}
+	return r.Status
+}
+
+// stopReason maps the reason a response is incomplete
+func (r ResponsesResponse) stopReason() llm.StopReason {
+	switch r.finishReason() {
+	case "max_output_tokens":
+		return llm.StopMaxTokens
+	case "content_filter":
+		return llm.StopContentFilter
+	}
+	return llm.StopCompleted
+}
+
+type responsesOutputItem struct {
+	Type string `json:"type"`
+
+	// message
+	Content []struct {
+		Type    string `json:"type"`
+		Text    string `json:"text"`
+		Refusal string `json:"refusal"`
+	} `json:"content"`
+
+	// function_call
+	CallId    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+
+	// reasoning
+	Summary []struct {
+		Text string `json:"text"`
+	} `json:"summary"`
+}
+
+// parseOutput converts the output items of a response into a round of the tool loop,
+// reasoning and built-in tool call items are stored on the message to be send back on the next turn
+func parseOutput(resp ResponsesResponse) (llm.RoundResult, error) {
+	round := llm.RoundResult{
+		Message:      llm.Message{Role: "assistant"},
+		Usage:        resp.Usage.toTokenUsage(),
+		StopReason:   resp.stopReason(),
+		FinishReason: resp.finishReason(),
+		Id:           resp.Id,
+	}
+	items := []json.RawMessage{}
+	for _, rawItem := range resp.Output {
+		item := responsesOutputItem{}
+		err := json.Unmarshal(rawItem, &item)
+		if err != nil {
+			return round, fmt.Errorf("failed to unmarshal output item: %s", err.Error())
+		}
+
+		switch item.Type {
+		case "message":
+			for _, content := range item.Content {
+				if content.Type == "refusal" {
+					return round, errors.New("model refused: " + content.Refusal)
+				}
+				round.Message.Content += content.Text
+			}
+		case "function_call":
+			round.Message.ToolCalls = append(round.Message.ToolCalls, llm.ToolCall{
+				Id:        item.CallId,
+				Name:      item.Name,
+				Arguments: item.Arguments,
+			})
+		case "reasoning":
+			for _, summary := range item.Summary {
+				round.Reasoning += summary.Text
+			}
+			items = append(items, rawItem)
+		default:
+			items = append(items, rawItem)
+		}
+	}
+
+	if len(items) > 0 {
+		reasoning, err := json.Marshal(items)
+		if err != nil {
+			return round, errors.New("failed to marshal reasoning: " + err.Error())
+		}
+		round.Message.Reasoning = reasoning
+	}
+	return round, nil
+}
+
+// ResponsesToolChoice forces the model to call a specific function
+type ResponsesToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+func toResponsesToolChoice(choice llm.ToolChoice) any {
+	switch choice.Mode {
+	case "":
+		return string(llm.ToolChoiceAuto)
+	case llm.ToolChoiceFunction:
+		return ResponsesToolChoice{Type: "function", Name: choice.Function}
+	}
+	return string(choice.Mode)
+}
+
+func toResponsesTools(tools []llm.Tool) []map[string]any {
+	if len(tools) == 0 {
+		return nil
+	}
+
+	responsesTools := make([]map[string]any, len(tools))
+	for idx, tool := range tools {
+		if !tool.IsFunction() {
+			responsesTool := map[string]any{"type": tool.Type}
+			for key, value := range tool.Params {
+				responsesTool[key] = value
+			}
+			responsesTools[idx] = responsesTool
+			continue
+		}
+
+		// Function tools are flat in the responses API
+		parameters := tool.Function.Parameters
+		if len(parameters) == 0 {
+			parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		responsesTools[idx] = map[string]any{
+			"type":        "function",
+			"name":        tool.Function.Name,
+			"description": tool.Function.Description,
+			"parameters":  parameters,
+			"strict":      tool.Function.Strict,
+		}
+	}
+	return responsesTools
+}
+
+// toResponsesInput converts the messages to input items. With a previous
+// response only the messages after the last assistant message are send as the
+// rest of the conversation is stored by OpenAI.
+func toResponsesInput(messages []llm.Message, previousResponseId string) ([]any, error) {
+	if previousResponseId != "" {
+		for idx := len(messages) - 1; idx >= 0; idx-- {
+			if messages[idx].Role == "assistant" {
+				messages = messages[idx+1:]
+				break
+			}
+		}
+	}
+
+	input := []any{}
+	for _, message := range messages {
+		switch message.Role {
+		case "system":
+			input = append(input, ResponsesInputMessage{Role: "developer", Content: message.Content})
+		case "assistant":
+			// Reasoning comes before the text and function calls, like in the output of a response
+			reasoningItems, err := unmarshalItems(message.Reasoning)
+			if err != nil {
+				return nil, err
+			}
+
+			input = append(input, reasoningItems...)
+			if message.Content != "" {
+				input = append(input, ResponsesInputMessage{Role: "assistant", Content: message.Content})
+			}
+			for _, toolCall := range message.ToolCalls {
+				input = append(input, ResponsesFunctionCall{
+					Type:      "function_call",
+					CallId:    toolCall.Id,
+					Name:      toolCall.Name,
+					Arguments: toolCall.Arguments,
+				})
+			}
+		case "tool":
+			input = append(input, ResponsesFunctionCallOutput{
+				Type:   "function_call_output",
+				CallId: message.ToolCallId,
+				Output: message.Content,
+			})
+		default:
+			if len(message.Parts) == 0 {
+				input = append(input, ResponsesInputMessage{Role: message.Role, Content: message.Content})
+				continue
+			}
+
+			content := []ResponsesInputContent{}
+			if message.Content != "" {
+				content = append(content, ResponsesInputContent{Type: "input_text", Text: message.Content})
+			}
+			for _, part := range message.Parts {
+				switch part.Type {
+				case llm.PartText:
+					content = append(content, ResponsesInputContent{Type: "input_text", Text: part.Text})
+				case llm.PartImage:
+					imageUrl := part.URL
+					if len(part.Data) > 0 {
+						imageUrl = part.DataURL()
+					}
+					content = append(content, ResponsesInputContent{Type: "input_image", ImageUrl: imageUrl})
+				case llm.PartFile:
+					if part.URL != "" && len(part.Data) == 0 {
+						content = append(content, ResponsesInputContent{Type: "input_file", FileUrl: part.URL})
+						continue
+					}
+					name := part.Name
+					if name == "" {
+						name = "file"
+					}
+					content = append(content, ResponsesInputContent{Type: "input_file", Filename: name, FileData: part.DataURL()})
+				default:
+					return nil, errors.New("unsupported part type " + string(part.Type))
+				}
+			}
+			input = append(input, ResponsesInputMessage{Role: message.Role, Content: content})
+		}
+	}
+	return input, nil
+}
+
+// unmarshalItems returns the reasoning and built-in tool call items stored on
+// a message, reasoning of other providers is ignored
+func unmarshalItems(raw json.RawMessage) ([]any, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	rawItems := []json.RawMessage{}
+	err := json.Unmarshal(raw, &rawItems)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling output items: %w", err)
+	}
+
+	items := []any{}
+	for _, rawItem := range rawItems {
+		item := struct {
+			Type string `json:"type"`
+		}{}
+		json.Unmarshal(rawItem, &item)
+		if item.Type == "reasoning" || strings.HasSuffix(item.Type, "_call") {
+			items = append(items, rawItem)
+		}
+	}
+	return items, nil
+}
+
+func (r *Responses) createRequest(stream bool, model string, messages []llm.Message, options llm.Options) (io.ReadCloser, error) {
+	if options.PreviousResponseId != "" && !r.Store {
+		return nil, errors.New("previous response id requires the responses to be stored")
+	}
+
+	input, err := toResponsesInput(messages, options.PreviousResponseId)
+	if err != nil {
+		return nil, err
+	}
+
+	reqBody := ResponsesRequest{
+		Model:              model,
+		Input:              input,
+		Store:              r.Store,
+		Stream:             stream,
+		Tools:              toResponsesTools(options.Tools),
+		MaxOutputTokens:    options.MaxTokens,
+		PreviousResponseId: options.PreviousResponseId,
+	}
+
+	if len(options.Tools) > 0 {
+		reqBody.ToolChoice = toResponsesToolChoice(options.ToolChoice)
+		reqBody.ParallelToolCalls = options.ParallelToolCalls
+	}
+
+	// The responses API only has temperature and top_p
+	sampling := openAiSampling(model, options.Thinking, toSampling(options))
+	reqBody.Temperature = sampling.Temperature
+	reqBody.TopP = sampling.TopP
+
+	if effort := reasoningEffort(model, options.Thinking); effort != "" {
+		reqBody.Reasoning = &ResponsesReasoning{Effort: effort}
+		if effort != "none" {
+			reqBody.Reasoning.Summary = "auto"
+			if !r.Store {
+				// Without storage the reasoning can only be carried to the next turn encrypted
+				reqBody.Include = []string{"reasoning.encrypted_content"}
+			}
+		}
+	}
+
+	switch options.ResponseFormat {
+	case llm.ResponseFormatJsonObject:
+		reqBody.Text = &ResponsesText{Format: ResponsesTextFormat{Type: "json_object"}}
+	case llm.ResponseFormatJsonSchema:
+		reqBody.Text = &ResponsesText{Format: ResponsesTextFormat{
+			Type:        "json_schema",
+			Name:        options.JsonSchema.Name,
+			Description: options.JsonSchema.Description,
+			Schema:      options.JsonSchema.Schema,
+			Strict:      options.JsonSchema.Strict,
+		}}
+	}
+
+	resp, err := openAi().newRequest("/v1/responses", reqBody, options.Timeout, options.Ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send responses request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fullResponse, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, llm.NewAPIError("openai", resp, fullResponse)
+	}
+
+	return resp.Body, nil
+}
+
+func (*Responses) SupportsStructuredOutput() bool {
+	return true
+}
+
+func (*Responses) SupportsJsonSchema() bool {
+	return true
+}
+
+func (*Responses) SupportsStreaming() bool {
+	return true
+}
+
+func (*Responses) SupportsTools() bool {
+	return true
+}
+
+// SupportsBuiltinTools returns true, tools like "web_search" run at openai
+func (*Responses) SupportsBuiltinTools() bool {
+	return true
+}
+
+func (*Responses) SupportsPart(partType llm.PartType) bool {
+	return partType == llm.PartText || partType == llm.PartImage || partType == llm.PartFile
+}
+
+func (r *Responses) Prompt(model string, messages []llm.Message, options llm.Options) (llm.Response, error) {
+	return llm.ToolLoop{
+		Options: options,
+		Round: func(messages []llm.Message, options llm.Options) (llm.RoundResult, error) {
+			return r.promptRound(model, messages, options)
+		},
+	}.Run(messages)
+}
+
+// promptRound sends a single request, the function calls in the answer are resolved by the llm.ToolLoop
+func (r *Responses) promptRound(model string, messages []llm.Message, options llm.Options) (llm.RoundResult, error) {
+	resp, err := r.createRequest(false, model, messages, options)
+	if err != nil {
+		return llm.RoundResult{}, err
+	}
+	defer resp.Close()
+
+	respContent := ResponsesResponse{}
+	err = json.NewDecoder(resp).Decode(&respContent)
+	if err != nil {
+		return llm.RoundResult{}, fmt.Errorf("decoding response: %s", err.Error())
+	}
+	if len(respContent.Error) > 0 && string(respContent.Error) != "null" {
+		return llm.RoundResult{}, llm.NewAPIError("openai", nil, respContent.Error)
+	}
+
+	round, err := parseOutput(respContent)
+	if err != nil {
+		return llm.RoundResult{}, err
+	}
+	if len(round.Message.ToolCalls) == 0 && round.Message.Content == "" && respContent.Status != "completed" {
+		return llm.RoundResult{}, errors.New("missing content, status: " + respContent.finishReason())
+	}
+	return round, nil
+}
+
+func (r *Responses) StreamEvents(model string, messages []llm.Message, options llm.Options) (chan llm.StreamEvent, error) {
+	resp, err := r.createRequest(true, model, messages, options)
+	if err != nil {
+		return nil, err
+	}
+
+	open := func(messages []llm.Message, options llm.Options) (io.ReadCloser, error) {
+		return r.createRequest(true, model, messages, options)
+	}
+	return llm.StreamToolLoop(resp, messages, options, open, readResponsesStream), nil
+}
+
+type responsesStreamEvent struct {
+	Type        string               `json:"type"`
+	OutputIndex int                  `json:"output_index"`
+	Delta       string               `json:"delta"`
+	Item        *responsesOutputItem `json:"item"`
+	Response    *ResponsesResponse   `json:"response"`
+	Code        string               `json:"code"`
+	Message     string               `json:"message"`
+}
+
+// readResponsesStream parses the server sent events of a responses stream and
+// forwards them as events, the completed response is returned as a round
+func readResponsesStream(resp io.Reader, events chan llm.StreamEvent) (llm.RoundResult, error) {
+	functionCalls := map[int]*llm.StreamToolCall{}
+
+	reader := bufio.NewReader(resp)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				return llm.RoundResult{}, errors.New("stream ended before the response completed")
+			}
+			return llm.RoundResult{}, fmt.Errorf("reading stream: %w", err)
+		}
+
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !ok {
+			continue
+		}
+
+		event := responsesStreamEvent{}
+		err = json.Unmarshal([]byte(strings.TrimSpace(data)), &event)
+		if err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "error":
+			return llm.RoundResult{}, &llm.APIError{Provider: "openai", Code: event.Code, Message: event.Message}
+		case "response.failed":
+			if event.Response != nil && len(event.Response.Error) > 0 {
+				return llm.RoundResult{}, llm.NewAPIError("openai", nil, event.Response.Error)
+			}
+			return llm.RoundResult{}, errors.New("response failed")
+		case "response.output_text.delta":
+			events <- llm.StreamEvent{Kind: llm.StreamText, Text: event.Delta}
+		case "response.reasoning_summary_text.delta":
+			events <- llm.StreamEvent{Kind: llm.StreamReasoning, Text: event.Delta}
+		case "response.output_item.added":
+			if event.Item == nil || event.Item.Type != "function_call" {
+				continue
+			}
+			toolCall := &llm.StreamToolCall{Index: event.OutputIndex, Id: event.Item.CallId, Name: event.Item.Name}
+			functionCalls[event.OutputIndex] = toolCall
+			events <- llm.StreamEvent{Kind: llm.StreamToolCallStarted, ToolCall: &llm.StreamToolCall{
+				Index: toolCall.Index,
+				Id:    toolCall.Id,
+				Name:  toolCall.Name,
+			}}
+		case "response.function_call_arguments.delta":
+			toolCall, ok := functionCalls[event.OutputIndex]
+			if !ok {
+				continue
+			}
+			toolCall.Arguments += event.Delta
+			events <- llm.StreamEvent{Kind: llm.StreamToolCallArgument, ToolCall: &llm.StreamToolCall{
+				Index:     toolCall.Index,
+				Id:        toolCall.Id,
+				Name:      toolCall.Name,
+				Arguments: event.Delta,
+			}}
+		case "response.output_item.done":
+			toolCall, ok := functionCalls[event.OutputIndex]
+			if !ok || event.Item == nil {
+				continue
+			}
+			finished := *toolCall
+			finished.Arguments = event.Item.Arguments
+			events <- llm.StreamEvent{Kind: llm.StreamToolCallFinished, ToolCall: &finished}
+		case "response.completed", "response.incomplete":
+			if event.Response == nil {
+				return llm.RoundResult{}, errors.New("missing response in " + event.Type)
+			}
+
+			// The final event holds the full response, so the round does not have to be build from the deltas
+			round, err := parseOutput(*event.Response)
+			if err != nil {
+				return round, err
+			}
+			events <- llm.StreamEvent{Kind: llm.StreamUsage, Usage: round.Usage}
+			events <- llm.StreamEvent{Kind: llm.StreamFinish, FinishReason: round.FinishReason, StopReason: round.StopReason, ResponseId: round.Id}
+			return round, nil
+		}
+	}
+}
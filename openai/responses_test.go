@@ -0,0 +1,182 @@
+package openai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+// Test function calls are resolved and send back together with the encrypted
+// reasoning items, and built-in tools are passed through.
+func TestResponsesFunctionCallsAndReasoning(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/responses" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			w.Write([]byte(`{"id":"resp_1","status":"completed","output":[{"type":"reasoning","id":"rs_1","encrypted_content":"secret","summary":[{"type":"summary_text","text":"Need the weather."}]},{"type":"function_call","id":"fc_1","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Amsterdam\"}"}],"usage":{"input_tokens":10,"output_tokens":5,"input_tokens_details":{"cached_tokens":2}}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"resp_2","status":"completed","output":[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"It is sunny."}]}],"usage":{"input_tokens":20,"output_tokens":4}}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	var gotArgs string
+	tools := []llm.Tool{
+		{
+			Type:     "function",
+			Function: llm.FunctionDef{Name: "get_weather"},
+			Resolver: func(args json.RawMessage) (any, error) {
+				gotArgs = string(args)
+				return "sunny", nil
+			},
+		},
+		{Type: "web_search", Params: map[string]any{"search_context_size": "low"}},
+	}
+
+	p := &Responses{}
+	resp, err := p.Prompt("gpt-5.4", []llm.Message{llm.System("be brief"), llm.User("weather?")}, llm.Options{Tools: tools, Thinking: llm.MediumThinking})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if resp.Value != "It is sunny." || resp.Id != "resp_2" || resp.Reasoning != "Need the weather." {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if gotArgs != `{"city":"Amsterdam"}` {
+		t.Errorf("wrong args threaded to resolver: %q", gotArgs)
+	}
+	want := llm.TokenUsage{InputTokens: 30, OutputTokens: 9, CachedInputTokens: 2}
+	if resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+
+	first := requests[0]
+	if first["store"] != false || first["include"] == nil {
+		t.Errorf("expected store false with encrypted reasoning, got %v %v", first["store"], first["include"])
+	}
+	firstTools := first["tools"].([]any)
+	if webSearch := firstTools[1].(map[string]any); webSearch["type"] != "web_search" || webSearch["search_context_size"] != "low" {
+		t.Errorf("built-in tool not passed through: %v", webSearch)
+	}
+	if first["input"].([]any)[0].(map[string]any)["role"] != "developer" {
+		t.Errorf("system message should be send as developer")
+	}
+
+	input := requests[1]["input"].([]any)
+	if len(input) != 5 {
+		t.Fatalf("expected developer, user, reasoning, function call and output items, got %d", len(input))
+	}
+	if reasoning := input[2].(map[string]any); reasoning["type"] != "reasoning" || reasoning["encrypted_content"] != "secret" {
+		t.Errorf("reasoning item not send back: %v", reasoning)
+	}
+	if output := input[4].(map[string]any); output["type"] != "function_call_output" || output["call_id"] != "call_1" || output["output"] != `"sunny"` {
+		t.Errorf("function call output not send back: %v", output)
+	}
+}
+
+// Test a stored response is continued by sending only the new messages.
+func TestResponsesPreviousResponseId(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	var gotReq map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&gotReq)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"resp_2","status":"completed","output":[{"type":"message","content":[{"type":"output_text","text":"Paris"}]}]}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	messages := []llm.Message{llm.User("hi"), llm.Assistant("hello"), llm.User("capital of France?")}
+	options := llm.Options{PreviousResponseId: "resp_1"}
+
+	_, err := (&Responses{}).Prompt("gpt-5.4", messages, options)
+	if err == nil {
+		t.Fatalf("expected an error when chaining without storing responses")
+	}
+
+	resp, err := (&Responses{Store: true}).Prompt("gpt-5.4", messages, options)
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if resp.Value != "Paris" || resp.Id != "resp_2" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if gotReq["previous_response_id"] != "resp_1" || gotReq["store"] != true {
+		t.Errorf("expected chaining to resp_1, got %v", gotReq)
+	}
+	if input := gotReq["input"].([]any); len(input) != 1 {
+		t.Errorf("expected only the new message to be send, got %v", input)
+	}
+}
+
+func TestResponsesStreamEvents(t *testing.T) {
+	os.Setenv("OPENAI_TOKEN", "test-token")
+	defer os.Unsetenv("OPENAI_TOKEN")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(strings.Join([]string{
+			`event: response.created`,
+			`data: {"type":"response.created","response":{"id":"resp_1","status":"in_progress"}}`,
+			``,
+			`event: response.reasoning_summary_text.delta`,
+			`data: {"type":"response.reasoning_summary_text.delta","output_index":0,"delta":"Thinking"}`,
+			``,
+			`event: response.output_text.delta`,
+			`data: {"type":"response.output_text.delta","output_index":1,"delta":"Hel"}`,
+			``,
+			`event: response.output_text.delta`,
+			`data: {"type":"response.output_text.delta","output_index":1,"delta":"lo"}`,
+			``,
+			`event: response.completed`,
+			`data: {"type":"response.completed","response":{"id":"resp_1","status":"completed","output":[{"type":"reasoning","summary":[{"type":"summary_text","text":"Thinking"}]},{"type":"message","content":[{"type":"output_text","text":"Hello"}]}],"usage":{"input_tokens":3,"output_tokens":2}}}`,
+			``,
+		}, "\n")))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	messages := []llm.Message{llm.User("hi")}
+	events, err := (&Responses{}).StreamEvents("gpt-5.4", messages, llm.Options{})
+	if err != nil {
+		t.Fatalf("StreamEvents returned error: %v", err)
+	}
+
+	resp, err := llm.CollectStream(messages, events)
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if resp.Value != "Hello" || resp.Reasoning != "Thinking" || resp.Id != "resp_1" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	want := llm.TokenUsage{InputTokens: 3, OutputTokens: 2}
+	if resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+}
@@ -0,0 +1,58 @@
+package openai
+
+import (
+	"errors"
+
+	"github.com/Back-to-code/go-llm"
+)
+
+// toToolCalls converts the tool calls of an answer, they are resolved by the llm.ToolLoop
+func toToolCalls(toolCalls []ToolCall) ([]llm.ToolCall, error) {
+	result := make([]llm.ToolCall, len(toolCalls))
+	for idx, toolCall := range toolCalls {
+		if toolCall.Type != "function" {
+			return nil, errors.New("unsupported tool type " + toolCall.Type)
+		}
+		if toolCall.Function == nil {
+			return nil, errors.New("missing function")
+		}
+		result[idx] = llm.ToolCall{
+			Id:        toolCall.Id,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		}
+	}
+	return result, nil
+}
+
+// NamedToolChoice forces the model to call a specific function
+type NamedToolChoice struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+	} `json:"function"`
+}
+
+// toToolChoice returns the tool_choice of a chat completions request
+func toToolChoice(choice llm.ToolChoice) any {
+	switch choice.Mode {
+	case "":
+		return string(llm.ToolChoiceAuto)
+	case llm.ToolChoiceFunction:
+		named := NamedToolChoice{Type: "function"}
+		named.Function.Name = choice.Function
+		return named
+	}
+	return string(choice.Mode)
+}
+
+// stopReason maps the finish_reason of a chat completion
+func stopReason(finishReason string) llm.StopReason {
+	switch finishReason {
+	case "length":
+		return llm.StopMaxTokens
+	case "content_filter":
+		return llm.StopContentFilter
+	}
+	return llm.StopCompleted
+}
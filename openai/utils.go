@@ -6,15 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
-
-	apikey "github.com/Back-to-code/go-llm/apikeys"
 )
 
 // BaseURL is the OpenAI API base URL. Exported for test overrides.
 var BaseURL = "https://api.openai.com"
 
-func newRequest(path string, body any, timeout time.Duration, ctx context.Context) (*http.Response, error) {
+func (c *Compatible) newRequest(path string, body any, timeout time.Duration, ctx context.Context) (*http.Response, error) {
 	// Convert request body to JSON
 	jsonData, err := json.Marshal(body)
 	if err != nil {
@@ -23,23 +22,41 @@ func newRequest(path string, body any, timeout time.Duration, ctx context.Contex
 
 	// Create the HTTP request
 	var req *http.Request
+	url := strings.TrimSuffix(c.Config.BaseURL, "/") + path
 	if ctx == nil {
-		req, err = http.NewRequest("POST", BaseURL+path, bytes.NewBuffer(jsonData))
+		req, err = http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	} else {
-		req, err = http.NewRequestWithContext(ctx, "POST", BaseURL+path, bytes.NewBuffer(jsonData))
+		req, err = http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	}
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
 
-	apiKey, err := apikey.OpenAi()
-	if err != nil {
-		return nil, err
-	}
-
 	// Add headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	for key, value := range c.Config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	if c.Config.ApiKey != nil {
+		apiKey, err := c.Config.ApiKey()
+		if err != nil {
+			return nil, err
+		}
+
+		header := c.Config.AuthHeader
+		if header == "" {
+			header = "Authorization"
+		}
+		scheme := c.Config.AuthScheme
+		if scheme == "" && header == "Authorization" {
+			scheme = "Bearer"
+		}
+		if scheme != "" {
+			apiKey = scheme + " " + apiKey
+		}
+		req.Header.Set(header, apiKey)
+	}
 
 	if timeout == 0 {
 		timeout = time.Second * 30
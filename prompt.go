@@ -8,9 +8,19 @@ import (
 type Message struct {
 	Role             string          `json:"role" validate:"required|llm_role"` // "user", "assistant", "system", "tool"
 	Content          string          `json:"content"`
-	ToolCalls        json.RawMessage `json:"-"`
-	ToolCallId       string          `json:"-"`
-	ThoughtSignature string          `json:"-"`
+	Parts            []Part          `json:"parts,omitempty"`        // Content besides the text like images, only for user messages
+	ToolCalls        []ToolCall      `json:"tool_calls,omitempty"`   // The tools called by an assistant message
+	ToolCallId       string          `json:"tool_call_id,omitempty"` // The call a tool message is the result of
+	ThoughtSignature string          `json:"thought_signature,omitempty"`
+	Reasoning        json.RawMessage `json:"reasoning,omitempty"` // Provider specific reasoning output that is send back on later turns, like encrypted reasoning items
+}
+
+// ToolCall is a call of the model to one of the tools. It is the same for every
+// provider so a conversation with tool calls can be continued on another provider.
+type ToolCall struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // The arguments as json
 }
 
 func System(content string) Message {
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DefaultPromptAsRetries is the amount of times PromptAs asks the model to fix
+// a response that could not be decoded
+var DefaultPromptAsRetries = 2
+
+// PromptAs prompts the model for a json response matching the schema derived
+// from T (see JsonSchemaFor) and decodes the response into T.
+//
+// If the response is invalid the error is appended to the conversation and the
+// model is asked to try again, up to DefaultPromptAsRetries times.
+// The returned Response contains the usage of all attempts.
+func PromptAs[T any](p Prompter, messages []Message, options Options) (T, Response, error) {
+	return PromptAsN[T](p, messages, options, DefaultPromptAsRetries)
+}
+
+// PromptAsN is PromptAs with the amount of times the model is asked to fix an invalid response, 0 does not retry
+func PromptAsN[T any](p Prompter, messages []Message, options Options, retries int) (T, Response, error) {
+	var value T
+
+	schema, node, err := jsonSchemaForType(reflect.TypeFor[T]())
+	if err != nil {
+		return value, Response{}, err
+	}
+	if options.JsonSchema != nil {
+		// Allow the caller to overwrite the name and description
+		if options.JsonSchema.Name != "" {
+			schema.Name = options.JsonSchema.Name
+		}
+		schema.Description = options.JsonSchema.Description
+	}
+	options.ResponseFormat = ResponseFormatJsonSchema
+	options.JsonSchema = schema
+
+	var usage TokenUsage
+	for attempt := 0; ; attempt++ {
+		resp, err := p.Prompt(messages, options)
+		usage.InputTokens += resp.Usage.InputTokens
+		usage.OutputTokens += resp.Usage.OutputTokens
+		usage.CachedInputTokens += resp.Usage.CachedInputTokens
+		resp.Usage = usage
+		if err != nil {
+			return value, resp, err
+		}
+
+		value = *new(T)
+		data := strings.TrimSpace(resp.Value)
+		if strings.HasPrefix(data, "```") || strings.HasPrefix(data, "~~~") {
+			data = ExtractFirstCodeBlock(data)
+		}
+		decodeErr := decodeAndValidate(node, []byte(data), &value)
+		if decodeErr == nil {
+			return value, resp, nil
+		}
+		if attempt >= retries {
+			return value, resp, fmt.Errorf("decoding response into %T: %w", value, decodeErr)
+		}
+
+		messages = append(resp.Conversation, UserLines(
+			"Your previous response did not match the required json schema: "+decodeErr.Error(),
+			"Reply again with only the corrected json.",
+		))
+	}
+}
@@ -0,0 +1,160 @@
+package llm_test
+
+import (
+	"strings"
+	"testing"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+type invoice struct {
+	Number   string  `json:"number" description:"The invoice number"`
+	Currency string  `json:"currency" enum:"EUR,USD"`
+	Total    float64 `json:"total"`
+	Notes    string  `json:"notes,omitempty"`
+	Lines    []struct {
+		Description string `json:"description"`
+		Amount      int    `json:"amount"`
+	} `json:"lines"`
+}
+
+func TestJsonSchemaFor(t *testing.T) {
+	schema, err := llm.JsonSchemaFor[invoice]()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if schema.Name != "invoice" {
+		t.Errorf("expected name 'invoice', got %q", schema.Name)
+	}
+	if !schema.Strict {
+		t.Error("expected a strict compatible schema")
+	}
+
+	want := `{"type":"object","properties":{` +
+		`"number":{"type":"string","description":"The invoice number"},` +
+		`"currency":{"type":"string","enum":["EUR","USD"]},` +
+		`"total":{"type":"number"},` +
+		`"notes":{"type":["string","null"]},` +
+		`"lines":{"type":"array","items":{"type":"object","properties":{"description":{"type":"string"},"amount":{"type":"integer"}},"required":["description","amount"],"additionalProperties":false}}` +
+		`},"required":["number","currency","total","notes","lines"],"additionalProperties":false}`
+	if string(schema.Schema) != want {
+		t.Errorf("unexpected schema:\n got  %s\n want %s", schema.Schema, want)
+	}
+
+	_, err = llm.JsonSchemaFor[[]string]()
+	if err == nil {
+		t.Error("expected an error for a non struct root")
+	}
+
+	// Only string enums get a null option, other enums rely on the null type
+	schema, err = llm.JsonSchemaFor[struct {
+		Priority int    `json:"priority,omitempty" enum:"1,2,3"`
+		Label    string `json:"label,omitempty" enum:"low,high"`
+	}]()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want = `{"type":"object","properties":{` +
+		`"priority":{"type":["integer","null"],"enum":[1,2,3]},` +
+		`"label":{"type":["string","null"],"enum":["low","high",null]}` +
+		`},"required":["priority","label"],"additionalProperties":false}`
+	if string(schema.Schema) != want {
+		t.Errorf("unexpected schema:\n got  %s\n want %s", schema.Schema, want)
+	}
+}
+
+func TestPromptAs_RetriesInvalidResponse(t *testing.T) {
+	responses := []string{
+		`{"number":"A1","currency":"GBP","total":10,"notes":null,"lines":[]}`,
+		`{"number":"A1","currency":"EUR","total":10,"notes":null,"lines":[{"description":"x","amount":10}]}`,
+	}
+	var lastMessages []llm.Message
+	var gotOptions llm.Options
+	p := &stubPrompter{
+		promptFn: func(messages []llm.Message, options llm.Options) (llm.Response, error) {
+			lastMessages = messages
+			gotOptions = options
+			value := responses[0]
+			responses = responses[1:]
+			return llm.Response{
+				Value:        value,
+				Conversation: append(messages, llm.Assistant(value)),
+				Usage:        llm.TokenUsage{InputTokens: 10, OutputTokens: 5},
+			}, nil
+		},
+	}
+
+	value, resp, err := llm.PromptAs[invoice](p, []llm.Message{llm.User("parse this")}, llm.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotOptions.ResponseFormat != llm.ResponseFormatJsonSchema || gotOptions.JsonSchema == nil {
+		t.Errorf("expected json schema response format, got %q", gotOptions.ResponseFormat)
+	}
+	if value.Currency != "EUR" || len(value.Lines) != 1 || value.Lines[0].Amount != 10 {
+		t.Errorf("unexpected decoded value: %+v", value)
+	}
+	if p.calls.Load() != 2 {
+		t.Errorf("expected 2 prompts, got %d", p.calls.Load())
+	}
+	if resp.Usage.InputTokens != 20 || resp.Usage.OutputTokens != 10 {
+		t.Errorf("expected accumulated usage, got %+v", resp.Usage)
+	}
+
+	// The second attempt should contain the failed answer and the validation error.
+	if len(lastMessages) != 3 {
+		t.Fatalf("expected 3 messages in retry conversation, got %d", len(lastMessages))
+	}
+	if !strings.Contains(lastMessages[2].Content, "GBP is not one of EUR, USD") {
+		t.Errorf("expected validation error in retry message, got %q", lastMessages[2].Content)
+	}
+}
+
+func TestPromptAs_OptionalFieldsMayBeLeftOut(t *testing.T) {
+	p := &stubPrompter{
+		promptFn: func(messages []llm.Message, _ llm.Options) (llm.Response, error) {
+			value := `{"number":"A1","currency":"EUR","total":10,"lines":[]}`
+			return llm.Response{Value: value, Conversation: append(messages, llm.Assistant(value))}, nil
+		},
+	}
+
+	value, _, err := llm.PromptAs[invoice](p, []llm.Message{llm.User("parse this")}, llm.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if value.Number != "A1" || value.Notes != "" || p.calls.Load() != 1 {
+		t.Errorf("expected the answer without notes to be accepted at once, got %+v after %d prompts", value, p.calls.Load())
+	}
+}
+
+func TestPromptAs_GivesUp(t *testing.T) {
+	p := &stubPrompter{
+		promptFn: func(messages []llm.Message, _ llm.Options) (llm.Response, error) {
+			return llm.Response{Value: `{"number":1}`, Conversation: messages}, nil
+		},
+	}
+
+	_, _, err := llm.PromptAs[invoice](p, []llm.Message{llm.User("parse this")}, llm.Options{})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if int(p.calls.Load()) != llm.DefaultPromptAsRetries+1 {
+		t.Errorf("expected %d prompts, got %d", llm.DefaultPromptAsRetries+1, p.calls.Load())
+	}
+}
+
+func TestPromptAsN(t *testing.T) {
+	p := &stubPrompter{
+		promptFn: func(messages []llm.Message, _ llm.Options) (llm.Response, error) {
+			return llm.Response{Value: `{"number":1}`, Conversation: messages}, nil
+		},
+	}
+
+	_, _, err := llm.PromptAsN[invoice](p, []llm.Message{llm.User("parse this")}, llm.Options{}, 0)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if p.calls.Load() != 1 {
+		t.Errorf("expected a single prompt without retries, got %d", p.calls.Load())
+	}
+}
@@ -2,9 +2,8 @@ package llm
 
 import (
 	"context"
-	"crypto/sha1"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -17,10 +16,18 @@ var DefaultCacheDuration = time.Hour * 24
 type ResponseFormat string
 
 var (
-	// ResponseFormatJsonSchema ResponseFormat = "json_schema" // (Unsupported)
+	ResponseFormatJsonSchema ResponseFormat = "json_schema" // Requires Options.JsonSchema
 	ResponseFormatJsonObject ResponseFormat = "json_object"
 )
 
+// JsonSchema describes the shape the model output must follow when using ResponseFormatJsonSchema
+type JsonSchema struct {
+	Name        string          `json:"name"` // Defaults to "response" if empty
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema"`
+	Strict      bool            `json:"strict"`
+}
+
 type Thinking uint8
 
 const (
@@ -33,23 +40,66 @@ const (
 
 type Options struct {
 	// Generically implemented
-	Cache   time.Duration // If <= 0, nothing will be cached
-	NoRetry bool
+	Cache         time.Duration  // If <= 0, nothing will be cached
+	CacheStore    cache.Store    // Overwrites Model.CacheStore
+	SemanticCache *SemanticCache // Overwrites Model.SemanticCache, only used when Cache is set
+	CacheChunk    int            // Streams a cached answer in chunks of this many characters, by default it is send at once
+	Retry         *RetryPolicy   // Overwrites Model.Retry, use NoRetry to only try once
 
 	// Implemented by each providers
 	Timeout        time.Duration // The request timeout
 	MaxTokens      int
 	Ctx            context.Context
 	ResponseFormat ResponseFormat
+	JsonSchema     *JsonSchema // Setting this implies ResponseFormatJsonSchema
 	Tools          []Tool
+	ToolChoice     ToolChoice
+	MaxToolRounds  int // The maximum number of times tools are called before the model must answer, defaults to DefaultMaxToolRounds
 	Thinking       Thinking
+
+	// ParallelToolCalls allows the model to call several tools in one turn, nil uses the provider default.
+	// Only supported by openai and anthropic.
+	ParallelToolCalls *bool
+	ToolConcurrency   int // The number of tool calls resolved at the same time, <= 1 resolves them one by one
+
+	// Sampling parameters, nil or empty means the provider default is used.
+	// Providers drop the parameters they or the model do not support, for example reasoning models reject most of them.
+	Temperature      *float64
+	TopP             *float64
+	Seed             *int
+	StopSequences    []string
+	PresencePenalty  *float64
+	FrequencyPenalty *float64
+	LogitBias        map[string]int // Token id to bias, between -100 and 100
+
+	// PreviousResponseId continues from a stored response, only the messages after the last assistant message are send.
+	// Only supported by providers that store responses like openai.Responses.
+	PreviousResponseId string
 }
 
-func (o Options) prepare(isStream bool, provider Provider) (Options, error) {
+func (o Options) prepare(isStream bool, provider Provider, messages []Message) (Options, error) {
 	if isStream && !provider.SupportsStreaming() {
 		return o, fmt.Errorf("provider %T does not support streaming", provider)
 	}
-	if o.ResponseFormat != "" && !provider.SupportsStructuredOutput() {
+	if err := validateParts(messages, provider); err != nil {
+		return o, err
+	}
+	if o.JsonSchema != nil && o.ResponseFormat == "" {
+		o.ResponseFormat = ResponseFormatJsonSchema
+	}
+	if o.ResponseFormat == ResponseFormatJsonSchema {
+		if !provider.SupportsJsonSchema() {
+			return o, fmt.Errorf("provider %T does not support json schema output", provider)
+		}
+		if o.JsonSchema == nil || len(o.JsonSchema.Schema) == 0 {
+			return o, errors.New("response format json_schema requires a JsonSchema")
+		}
+		if o.JsonSchema.Name == "" {
+			schema := *o.JsonSchema
+			schema.Name = "response"
+			o.JsonSchema = &schema
+		}
+	} else if o.ResponseFormat != "" && !provider.SupportsStructuredOutput() {
 		return o, fmt.Errorf("provider %T does not support structured output", provider)
 	}
 	if len(o.Tools) > 0 && !provider.SupportsTools() {
@@ -60,36 +110,92 @@ func (o Options) prepare(isStream bool, provider Provider) (Options, error) {
 		o.Timeout = time.Second * 30
 	}
 	for idx, tool := range o.Tools {
-		if tool.Resolver == nil {
+		if tool.contextResolver() == nil && tool.IsFunction() {
 			return o, fmt.Errorf("tool %s (#%d) is missing a resolver", tool.Function.Name, idx+1)
 		}
+		if !tool.IsFunction() && !supportsBuiltinTools(provider) {
+			return o, fmt.Errorf("provider %T does not support the built-in tool %s (#%d)", provider, tool.Type, idx+1)
+		}
 		if tool.Type == "" {
 			tool.Type = "function"
 			o.Tools[idx] = tool
 		}
+		if tool.Strict && !tool.Function.Strict {
+			tool.Function.Strict = true
+			o.Tools[idx] = tool
+		}
+	}
+	if err := o.validateToolChoice(); err != nil {
+		return o, err
 	}
 
 	return o, nil
 }
 
+func (o Options) validateToolChoice() error {
+	switch o.ToolChoice.Mode {
+	case "", ToolChoiceAuto, ToolChoiceNone:
+		return nil
+	case ToolChoiceRequired:
+		if len(o.Tools) == 0 {
+			return errors.New("tool choice required needs at least one tool")
+		}
+		return nil
+	case ToolChoiceFunction:
+		for _, tool := range o.Tools {
+			if tool.IsFunction() && tool.Function.Name == o.ToolChoice.Function {
+				return nil
+			}
+		}
+		return fmt.Errorf("tool choice %q does not match any tool", o.ToolChoice.Function)
+	}
+	return fmt.Errorf("unknown tool choice mode %q", o.ToolChoice.Mode)
+}
+
+// Ptr returns a pointer to v, useful for the optional sampling parameters like Options.Temperature
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// BuiltinToolsProvider is implemented by providers that can run built-in tools
+// like "web_search", other providers only accept function tools
+type BuiltinToolsProvider interface {
+	SupportsBuiltinTools() bool
+}
+
+func supportsBuiltinTools(provider Provider) bool {
+	builtin, ok := provider.(BuiltinToolsProvider)
+	return ok && builtin.SupportsBuiltinTools()
+}
+
 type Provider interface {
 	Prompt(model string, messages []Message, options Options) (Response, error)
-	Stream(model string, messages []Message, options Options) (chan string, error)
+	// StreamEvents starts a streaming request, the returned channel is closed once the stream ends.
+	// Errors that happen after the request was accepted are send as a StreamError event.
+	StreamEvents(model string, messages []Message, options Options) (chan StreamEvent, error)
 	SupportsStructuredOutput() bool
+	SupportsJsonSchema() bool
 	SupportsStreaming() bool
 	SupportsTools() bool
+	// SupportsPart reports if messages may contain parts of the given type, text parts are always supported
+	SupportsPart(partType PartType) bool
 }
 
 type Prompter interface {
 	Prompt(messages []Message, options Options) (Response, error)
 	PromptSingle(message string, options Options) (Response, error)
 	Stream(messages []Message, options Options) (chan string, error)
+	StreamEvents(messages []Message, options Options) (chan StreamEvent, error)
 	ModelName() string
 }
 
 type Model struct {
-	Name     string
-	Provider Provider
+	Name       string
+	Provider   Provider
+	Retry      *RetryPolicy // Defaults to DefaultRetryPolicy
+	CacheStore cache.Store  // Used when Options.Cache is set, defaults to cache.Global
+	// SemanticCache also looks up responses to similar questions when Options.Cache is set, disabled if nil
+	SemanticCache *SemanticCache
 }
 
 func (m *Model) ModelName() string {
@@ -101,55 +207,47 @@ func (m *Model) ModelName() string {
 
 func (m *Model) Prompt(messages []Message, options Options) (Response, error) {
 	var err error
-	options, err = options.prepare(false, m.Provider)
+	options, err = options.prepare(false, m.Provider, messages)
 	if err != nil {
 		return Response{}, err
 	}
 
-	retries := 5
-	if options.NoRetry {
-		retries = 1
-	}
-
-	var cacheKey string
-	if options.Cache > 0 {
-		cacheKeyHashContents, err := json.Marshal(messages)
-		if err == nil {
-			cacheKeyHash := sha1.New()
-			cacheKeyHash.Write(cacheKeyHashContents)
-			cacheKey = m.Name + ":" + hex.EncodeToString(cacheKeyHash.Sum(nil))
-			cachedResponse, err := cache.Get(cacheKey)
-			if err == nil && cachedResponse != "" {
-				return Response{
-					Value:        cachedResponse,
-					Conversation: messages,
-				}, nil
-			}
-		}
+	promptCache := m.newPromptCache(messages, options)
+	if resp, ok := promptCache.get(messages); ok {
+		return resp, nil
 	}
 
 	var resp Response
-	for i := 0; i < retries; i++ {
-		if options.Ctx != nil && options.Ctx.Err() != nil {
-			return Response{}, options.Ctx.Err()
-		}
-
-		start := time.Now()
+	err = m.retryPolicy(options).run(options.Ctx, func() error {
 		resp, err = m.Provider.Prompt(m.Name, messages, options)
-		if err != nil {
-			if time.Since(start) < time.Second {
-				time.Sleep(time.Millisecond * 100 * (time.Duration(i) + 1))
-			}
-			continue
-		}
-
-		if cacheKey != "" {
-			cache.Set(cacheKey, resp.Value, options.Cache)
-		}
+		return err
+	})
+	if err != nil {
 		return resp, err
 	}
 
-	return resp, err
+	promptCache.set(resp)
+	return resp, nil
+}
+
+func (m *Model) cacheStore(options Options) cache.Store {
+	if options.CacheStore != nil {
+		return options.CacheStore
+	}
+	if m.CacheStore != nil {
+		return m.CacheStore
+	}
+	return cache.Global
+}
+
+func (m *Model) retryPolicy(options Options) RetryPolicy {
+	if options.Retry != nil {
+		return *options.Retry
+	}
+	if m.Retry != nil {
+		return *m.Retry
+	}
+	return DefaultRetryPolicy
 }
 
 // PromptSingle is a wrapper around prompt but only prompt 1 user message
@@ -157,13 +255,48 @@ func (m *Model) PromptSingle(message string, options Options) (Response, error)
 	return m.Prompt([]Message{User(message)}, options)
 }
 
+// Stream is a wrapper around StreamEvents that only returns the text deltas
 func (m *Model) Stream(messages []Message, options Options) (chan string, error) {
+	events, err := m.StreamEvents(messages, options)
+	if err != nil {
+		return nil, err
+	}
+	return TextStream(events), nil
+}
+
+func (m *Model) StreamEvents(messages []Message, options Options) (chan StreamEvent, error) {
 	var err error
-	options, err = options.prepare(true, m.Provider)
+	options, err = options.prepare(true, m.Provider, messages)
 	if err != nil {
 		return nil, err
 	}
 
+	promptCache := m.newPromptCache(messages, options)
+	if resp, ok := promptCache.get(messages); ok {
+		return cachedStream(resp, messages, options.CacheChunk), nil
+	}
+
 	log.Info("Sending prompt to " + m.Name)
-	return m.Provider.Stream(m.Name, messages, options)
+
+	// Failures before the first output are retried like Prompt does, once the
+	// answer started streaming errors are send to the caller as StreamError
+	var events chan StreamEvent
+	var streamErr error
+	err = m.retryPolicy(options).run(options.Ctx, func() error {
+		stream, err := m.Provider.StreamEvents(m.Name, messages, options)
+		streamErr = nil
+		if err != nil {
+			return err
+		}
+		events, streamErr = awaitOutput(stream)
+		return streamErr
+	})
+	if err != nil && err == streamErr {
+		// The request was accepted, so report the error like the provider would
+		return errorStream(err), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return promptCache.cacheStream(messages, events), nil
 }
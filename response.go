@@ -9,17 +9,44 @@ type TokenUsage struct {
 
 // Response is the return type for Prompt and PromptSingle calls.
 type Response struct {
-	// Value is the final text content returned by the model.
+	// Value is the final text content returned by the model. It is empty
+	// when StopReason is StopMaxToolRounds as the model did not answer.
 	Value string
 
 	// Conversation contains all messages up to and including the final
 	// assistant response. When tool calls are involved this includes the
 	// intermediate assistant tool-call messages and tool response messages.
+	// With StopMaxToolRounds it ends with the last tool results instead, the
+	// assistant message with the unresolved tool calls is left out.
 	Conversation []Message
 
 	// Usage holds the accumulated token usage across all API round-trips
 	// that occurred during this call (including tool-call loops).
 	Usage TokenUsage
+
+	// Id identifies the final response for providers that store responses,
+	// it can be passed as Options.PreviousResponseId to continue from it.
+	Id string
+
+	// Reasoning holds the reasoning (summary) text of the model for
+	// providers that return it.
+	Reasoning string
+
+	// StopReason tells why the model stopped, like StopMaxTokens when the
+	// answer was cut off.
+	StopReason StopReason
+
+	// Rounds traces every request that was made for this call, there is
+	// more than one when tools are called.
+	Rounds []Round
+
+	// Cached is true when the response was read from the cache instead of
+	// requested from the provider, see Options.Cache.
+	Cached bool `json:"-"`
+
+	// CacheSimilarity is the cosine similarity of the question with the cached
+	// question for hits of the semantic cache, it is 1 for exact hits.
+	CacheSimilarity float64 `json:"-"`
 }
 
 // String returns the Value field, making it easy to migrate from the old
@@ -0,0 +1,280 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/Back-to-code/go-llm/cache"
+	"github.com/Back-to-code/go-llm/log"
+)
+
+// responseCacheVersion is stored with every cached response, bump it when the
+// key or the stored Response changes so old entries are ignored
+const responseCacheVersion = 1
+
+// cacheKeyContents contains everything that changes the output of a prompt
+type cacheKeyContents struct {
+	Version            int            `json:"version"`
+	Model              string         `json:"model"`
+	Messages           []Message      `json:"messages"`
+	ResponseFormat     ResponseFormat `json:"response_format,omitempty"`
+	JsonSchema         *JsonSchema    `json:"json_schema,omitempty"`
+	Tools              []cacheKeyTool `json:"tools,omitempty"`
+	ToolChoice         *ToolChoice    `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool          `json:"parallel_tool_calls,omitempty"`
+	MaxToolRounds      int            `json:"max_tool_rounds,omitempty"`
+	Thinking           Thinking       `json:"thinking,omitempty"`
+	MaxTokens          int            `json:"max_tokens,omitempty"`
+	Temperature        *float64       `json:"temperature,omitempty"`
+	TopP               *float64       `json:"top_p,omitempty"`
+	Seed               *int           `json:"seed,omitempty"`
+	StopSequences      []string       `json:"stop_sequences,omitempty"`
+	PresencePenalty    *float64       `json:"presence_penalty,omitempty"`
+	FrequencyPenalty   *float64       `json:"frequency_penalty,omitempty"`
+	LogitBias          map[string]int `json:"logit_bias,omitempty"`
+	PreviousResponseId string         `json:"previous_response_id,omitempty"`
+}
+
+// cacheKeyTool is the definition of a tool without its resolver
+type cacheKeyTool struct {
+	Type     string         `json:"type"`
+	Function FunctionDef    `json:"function"`
+	Params   map[string]any `json:"params,omitempty"`
+}
+
+// cacheKey returns the key a response to the messages is cached under
+func cacheKey(model string, messages []Message, options Options) (string, error) {
+	contents := cacheKeyContents{
+		Version:            responseCacheVersion,
+		Model:              model,
+		Messages:           messages,
+		ResponseFormat:     options.ResponseFormat,
+		JsonSchema:         options.JsonSchema,
+		ParallelToolCalls:  options.ParallelToolCalls,
+		MaxToolRounds:      options.MaxToolRounds,
+		Thinking:           options.Thinking,
+		MaxTokens:          options.MaxTokens,
+		Temperature:        options.Temperature,
+		TopP:               options.TopP,
+		Seed:               options.Seed,
+		StopSequences:      options.StopSequences,
+		PresencePenalty:    options.PresencePenalty,
+		FrequencyPenalty:   options.FrequencyPenalty,
+		LogitBias:          options.LogitBias,
+		PreviousResponseId: options.PreviousResponseId,
+	}
+	if options.ToolChoice.Mode != "" {
+		contents.ToolChoice = &options.ToolChoice
+	}
+	for _, tool := range options.Tools {
+		contents.Tools = append(contents.Tools, cacheKeyTool{
+			Type:     tool.Type,
+			Function: tool.Function,
+			Params:   tool.Params,
+		})
+	}
+
+	cacheKeyHashContents, err := json.Marshal(contents)
+	if err != nil {
+		return "", err
+	}
+	cacheKeyHash := sha1.New()
+	cacheKeyHash.Write(cacheKeyHashContents)
+	return model + ":" + hex.EncodeToString(cacheKeyHash.Sum(nil)), nil
+}
+
+type cachedResponse struct {
+	Version  int      `json:"version"`
+	Response Response `json:"response"`
+}
+
+func encodeCachedResponse(resp Response) (string, error) {
+	encoded, err := json.Marshal(cachedResponse{Version: responseCacheVersion, Response: resp})
+	return string(encoded), err
+}
+
+// decodeCachedResponse returns an error for entries of another version, like a value cached by an older version of this library
+func decodeCachedResponse(value string) (Response, error) {
+	var cached cachedResponse
+	err := json.Unmarshal([]byte(value), &cached)
+	if err != nil {
+		return Response{}, err
+	}
+	if cached.Version != responseCacheVersion {
+		return Response{}, errors.New("cached response has another version")
+	}
+
+	cached.Response.Cached = true
+	return cached.Response, nil
+}
+
+// promptCache reads and writes the cached response of a single prompt, it is nil when caching is disabled
+type promptCache struct {
+	store    cache.Store
+	key      string
+	duration time.Duration
+
+	ctx       context.Context
+	semantic  *SemanticCache // nil if the semantic cache is disabled or can not be used for the messages
+	partition string         // The key of all messages except the final user message
+	text      string         // The text of the final user message
+	vector    []float32      // The embedding of text, set by get
+}
+
+func (m *Model) newPromptCache(messages []Message, options Options) *promptCache {
+	if options.Cache <= 0 {
+		return nil
+	}
+	key, err := cacheKey(m.Name, messages, options)
+	if err != nil {
+		// Without a key the response is not cached
+		return nil
+	}
+	c := &promptCache{
+		store:    m.cacheStore(options),
+		key:      key,
+		duration: options.Cache,
+	}
+
+	semantic := options.SemanticCache
+	if semantic == nil {
+		semantic = m.SemanticCache
+	}
+	if semantic == nil || semantic.Embedder == nil || semantic.Index == nil || len(messages) == 0 {
+		return c
+	}
+	text, ok := semanticText(messages[len(messages)-1])
+	partition, err := cacheKey(m.Name, messages[:len(messages)-1], options)
+	if ok && text != "" && err == nil {
+		c.ctx = options.Ctx
+		if c.ctx == nil {
+			c.ctx = context.Background()
+		}
+		c.semantic = semantic
+		c.partition = partition
+		c.text = text
+	}
+	return c
+}
+
+// get returns the exactly matching response, or otherwise the most similar response of the semantic cache
+func (c *promptCache) get(messages []Message) (Response, bool) {
+	if c == nil {
+		return Response{}, false
+	}
+
+	value, err := c.store.Get(c.key)
+	if err == nil && value != "" {
+		if resp, err := decodeCachedResponse(value); err == nil {
+			resp.CacheSimilarity = 1
+			return resp, true
+		}
+	}
+
+	if c.semantic == nil {
+		return Response{}, false
+	}
+	c.vector, err = c.semantic.Embedder.Embed(c.ctx, c.text)
+	if err != nil {
+		log.Info("semantic cache embedding failed: " + err.Error())
+		return Response{}, false
+	}
+	value, similarity, err := c.semantic.Index.Nearest(c.partition, c.vector)
+	if err != nil || value == "" || similarity < c.semantic.threshold() {
+		return Response{}, false
+	}
+	resp, err := decodeCachedResponse(value)
+	if err != nil || len(resp.Conversation) < len(messages) {
+		return Response{}, false
+	}
+
+	// The cached conversation starts with the other wording of the question
+	resp.Conversation = append(slices.Clone(messages), resp.Conversation[len(messages):]...)
+	resp.CacheSimilarity = similarity
+	return resp, true
+}
+
+func (c *promptCache) set(resp Response) {
+	if c == nil {
+		return
+	}
+	value, err := encodeCachedResponse(resp)
+	if err != nil {
+		return
+	}
+
+	c.store.Set(c.key, value, c.duration)
+	if c.semantic != nil && c.vector != nil {
+		c.semantic.Index.Add(c.partition, c.vector, value, c.duration)
+	}
+}
+
+// cacheStream passes the events through and caches the response once the stream finished without errors
+func (c *promptCache) cacheStream(messages []Message, events chan StreamEvent) chan StreamEvent {
+	if c == nil {
+		return events
+	}
+
+	passed := make(chan StreamEvent)
+	go func() {
+		defer close(passed)
+		collector := newStreamCollector(messages)
+		for event := range events {
+			collector.add(event)
+			passed <- event
+		}
+		if collector.err == nil && collector.finished {
+			c.set(collector.response())
+		}
+	}()
+	return passed
+}
+
+// cachedStream replays a cached response to messages as a stream, the answer is
+// split in chunks of chunkSize characters or send at once if chunkSize is 0
+func cachedStream(resp Response, messages []Message, chunkSize int) chan StreamEvent {
+	var events []StreamEvent
+	if resp.Reasoning != "" {
+		events = append(events, StreamEvent{Kind: StreamReasoning, Text: resp.Reasoning})
+	}
+
+	// Tool calls and their results that happened before the final answer,
+	// without an answer the conversation ends with tool results
+	answerIdx := len(resp.Conversation) - 1
+	if resp.StopReason == StopMaxToolRounds {
+		answerIdx = len(resp.Conversation)
+	}
+	for idx := len(messages); idx < answerIdx; idx++ {
+		events = append(events, StreamEvent{Kind: StreamMessage, Message: &resp.Conversation[idx]})
+	}
+	for idx := range resp.Rounds {
+		events = append(events, StreamEvent{Kind: StreamRound, Round: &resp.Rounds[idx]})
+	}
+
+	value := []rune(resp.Value)
+	if chunkSize <= 0 {
+		chunkSize = len(value)
+	}
+	for start := 0; start < len(value); start += chunkSize {
+		end := min(start+chunkSize, len(value))
+		events = append(events, StreamEvent{Kind: StreamText, Text: string(value[start:end])})
+	}
+
+	if answerIdx < len(resp.Conversation) && answerIdx >= len(messages) {
+		if final := &resp.Conversation[answerIdx]; final.Role == "assistant" && len(final.ToolCalls) == 0 {
+			// The final message keeps the reasoning and thought signature of the answer
+			events = append(events, StreamEvent{Kind: StreamMessage, Message: final})
+		}
+	}
+
+	events = append(events,
+		StreamEvent{Kind: StreamUsage, Usage: resp.Usage},
+		StreamEvent{Kind: StreamFinish, FinishReason: "stop", StopReason: resp.StopReason, ResponseId: resp.Id, Cached: true},
+	)
+	return replayStream(events, nil)
+}
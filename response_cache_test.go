@@ -0,0 +1,272 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	llm "github.com/Back-to-code/go-llm"
+	"github.com/Back-to-code/go-llm/cache"
+)
+
+// useMapCache installs a map as the cache for the duration of the test
+func useMapCache(t *testing.T) map[string]string {
+	values := map[string]string{}
+	prevGetter, prevSetter := cache.Getter, cache.Setter
+	cache.Getter = func(key string) (string, error) { return values[key], nil }
+	cache.Setter = func(key, value string, _ time.Duration) error {
+		values[key] = value
+		return nil
+	}
+	t.Cleanup(func() { cache.Getter, cache.Setter = prevGetter, prevSetter })
+	return values
+}
+
+func TestPromptCache(t *testing.T) {
+	values := useMapCache(t)
+
+	sp := &stubProvider{}
+	sp.promptFn = func(model string, messages []llm.Message, options llm.Options) (llm.Response, error) {
+		resp, err := okPromptProvider("paris")(model, messages, options)
+		resp.Usage = llm.TokenUsage{InputTokens: 10, OutputTokens: 2}
+		return resp, err
+	}
+	model := &llm.Model{Name: "stub", Provider: sp}
+	messages := []llm.Message{llm.User("capital of france?")}
+
+	first, err := model.Prompt(messages, llm.Options{Cache: time.Hour})
+	if err != nil || first.Cached {
+		t.Fatalf("expected an uncached response, got %+v, %v", first, err)
+	}
+
+	second, err := model.Prompt(messages, llm.Options{Cache: time.Hour})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !second.Cached || second.Value != "paris" || second.Usage != first.Usage || len(second.Conversation) != 2 {
+		t.Errorf("cached response does not match the original: %+v", second)
+	}
+	if sp.promptCalls.Load() != 1 {
+		t.Errorf("expected the provider to be called once, got %d", sp.promptCalls.Load())
+	}
+
+	// Options that change the output use another key
+	variants := []llm.Options{
+		{Cache: time.Hour, ResponseFormat: llm.ResponseFormatJsonObject},
+		{Cache: time.Hour, Thinking: llm.HighThinking},
+		{Cache: time.Hour, MaxTokens: 10},
+		{Cache: time.Hour, Temperature: llm.Ptr(0.0)},
+		{Cache: time.Hour, Tools: []llm.Tool{{Function: llm.FunctionDef{Name: "lookup"}, Resolver: func(json.RawMessage) (any, error) { return nil, nil }}}},
+	}
+	for _, options := range variants {
+		resp, err := model.Prompt(messages, options)
+		if err != nil || resp.Cached {
+			t.Errorf("expected a cache miss for %+v, got cached=%v err=%v", options, resp.Cached, err)
+		}
+	}
+	if len(values) != 1+len(variants) {
+		t.Errorf("expected %d cache entries, got %d", 1+len(variants), len(values))
+	}
+
+	// Options that do not change the output share the key
+	resp, err := model.Prompt(messages, llm.Options{Cache: time.Hour, Timeout: time.Minute, Retry: llm.NoRetry})
+	if err != nil || !resp.Cached {
+		t.Errorf("expected a cache hit, got cached=%v err=%v", resp.Cached, err)
+	}
+}
+
+func TestPromptCacheStore(t *testing.T) {
+	global := useMapCache(t)
+
+	sp := &stubProvider{promptFn: okPromptProvider("ok")}
+	modelStore := cache.NewLRU(10)
+	model := &llm.Model{Name: "stub", Provider: sp, CacheStore: modelStore}
+
+	model.PromptSingle("hi", llm.Options{Cache: time.Hour})
+	if modelStore.Len() != 1 || len(global) != 0 {
+		t.Errorf("expected the response in the model store, got %d in the model store and %d global", modelStore.Len(), len(global))
+	}
+
+	optionsStore := cache.NewLRU(10)
+	resp, _ := model.PromptSingle("hi", llm.Options{Cache: time.Hour, CacheStore: optionsStore})
+	if resp.Cached || optionsStore.Len() != 1 {
+		t.Errorf("expected Options.CacheStore to overwrite the model store")
+	}
+}
+
+func TestPromptSemanticCache(t *testing.T) {
+	useMapCache(t)
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "prompt")
+
+	// Questions about passwords point the same way
+	embedder := llm.EmbedderFunc(func(embedCtx context.Context, text string) ([]float32, error) {
+		if embedCtx.Value(ctxKey{}) != "prompt" {
+			t.Errorf("expected the embedder to get Options.Ctx")
+		}
+		if strings.Contains(text, "password") {
+			return []float32{1, 0.1 * float32(len(text)%3)}, nil
+		}
+		return []float32{0, 1}, nil
+	})
+
+	sp := &stubProvider{promptFn: okPromptProvider("use the reset link")}
+	model := &llm.Model{Name: "stub", Provider: sp, SemanticCache: llm.NewSemanticCache(embedder)}
+	options := llm.Options{Cache: time.Hour, Ctx: ctx}
+
+	model.PromptSingle("How do I reset my password?", options)
+
+	resp, err := model.PromptSingle("I forgot my password, what now?", options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !resp.Cached || resp.CacheSimilarity < 0.95 || resp.CacheSimilarity >= 1 {
+		t.Errorf("expected a semantic cache hit, got cached=%v similarity=%f", resp.Cached, resp.CacheSimilarity)
+	}
+	if resp.Conversation[0].Content != "I forgot my password, what now?" || resp.Conversation[1].Content != "use the reset link" {
+		t.Errorf("conversation does not continue from the new question: %+v", resp.Conversation)
+	}
+
+	resp, _ = model.PromptSingle("What are your opening hours?", options)
+	if resp.Cached {
+		t.Errorf("expected a different question to miss the cache")
+	}
+
+	// Other options do not share answers
+	resp, _ = model.PromptSingle("Password reset?", llm.Options{Cache: time.Hour, MaxTokens: 10, Ctx: ctx})
+	if resp.Cached {
+		t.Errorf("expected different options to miss the cache")
+	}
+	if sp.promptCalls.Load() != 3 {
+		t.Errorf("expected 3 provider calls, got %d", sp.promptCalls.Load())
+	}
+}
+
+func TestStreamCache(t *testing.T) {
+	values := useMapCache(t)
+
+	fail := true
+	sp := &stubProvider{}
+	sp.streamFn = func(string, []llm.Message, llm.Options) (chan llm.StreamEvent, error) {
+		if fail {
+			return eventStream(
+				llm.StreamEvent{Kind: llm.StreamText, Text: "hel"},
+				llm.StreamEvent{Kind: llm.StreamError, Err: errors.New("connection lost")},
+			), nil
+		}
+		return eventStream(
+			llm.StreamEvent{Kind: llm.StreamText, Text: "hello"},
+			llm.StreamEvent{Kind: llm.StreamUsage, Usage: llm.TokenUsage{InputTokens: 4, OutputTokens: 1}},
+			llm.StreamEvent{Kind: llm.StreamFinish, FinishReason: "stop"},
+		), nil
+	}
+	model := &llm.Model{Name: "stub", Provider: sp, Retry: llm.NoRetry}
+	messages := []llm.Message{llm.User("hi")}
+	options := llm.Options{Cache: time.Hour, CacheChunk: 2}
+
+	// Errored streams are not cached
+	events, _ := model.StreamEvents(messages, options)
+	llm.CollectStream(messages, events)
+	if len(values) != 0 {
+		t.Fatalf("expected the errored stream not to be cached")
+	}
+
+	fail = false
+	events, _ = model.StreamEvents(messages, options)
+	first, err := llm.CollectStream(messages, events)
+	if err != nil || first.Cached {
+		t.Fatalf("expected an uncached response, got cached=%v err=%v", first.Cached, err)
+	}
+
+	events, err = model.StreamEvents(messages, options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var chunks []string
+	for event := range events {
+		if event.Kind == llm.StreamText {
+			chunks = append(chunks, event.Text)
+		}
+		if event.Kind == llm.StreamFinish && !event.Cached {
+			t.Errorf("expected the finish event to be marked as cached")
+		}
+	}
+	if strings.Join(chunks, "|") != "he|ll|o" {
+		t.Errorf("expected the cached answer in chunks of 2, got %q", chunks)
+	}
+	if sp.streamCalls.Load() != 2 {
+		t.Errorf("expected 2 provider calls, got %d", sp.streamCalls.Load())
+	}
+
+	// Prompt and stream share the cache
+	resp, err := model.Prompt(messages, options)
+	if err != nil || !resp.Cached || resp.Value != "hello" || resp.Usage != first.Usage {
+		t.Errorf("expected the streamed response from the cache, got %+v, %v", resp, err)
+	}
+}
+
+// Test a cached response that stopped at the maximum of tool rounds is replayed with its tool results.
+func TestStreamCacheMaxToolRounds(t *testing.T) {
+	useMapCache(t)
+
+	sp := &stubProvider{}
+	sp.promptFn = func(_ string, messages []llm.Message, _ llm.Options) (llm.Response, error) {
+		return llm.Response{
+			Conversation: append(messages,
+				llm.Message{Role: "assistant", ToolCalls: []llm.ToolCall{{Id: "call_1", Name: "lookup", Arguments: `{}`}}},
+				llm.Message{Role: "tool", ToolCallId: "call_1", Content: `"found"`},
+			),
+			StopReason: llm.StopMaxToolRounds,
+		}, nil
+	}
+	model := &llm.Model{Name: "stub", Provider: sp}
+	messages := []llm.Message{llm.User("hi")}
+
+	model.Prompt(messages, llm.Options{Cache: time.Hour})
+	events, err := model.StreamEvents(messages, llm.Options{Cache: time.Hour})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	resp, _ := llm.CollectStream(messages, events)
+	if !resp.Cached || len(resp.Conversation) != 3 || resp.Conversation[2].Role != "tool" {
+		t.Errorf("expected the cached conversation to end with the tool result, got %+v", resp.Conversation)
+	}
+}
+
+// Test a replayed stream keeps the final message and rounds of the tool loop.
+func TestStreamCacheToolLoop(t *testing.T) {
+	useMapCache(t)
+
+	calls := 0
+	sp := &stubProvider{}
+	sp.streamFn = func(_ string, messages []llm.Message, _ llm.Options) (chan llm.StreamEvent, error) {
+		events := make(chan llm.StreamEvent)
+		go answerLoop(&calls, events).Stream(messages, events)
+		return events, nil
+	}
+	model := &llm.Model{Name: "stub", Provider: sp}
+	messages := []llm.Message{llm.User("hi")}
+
+	events, _ := model.StreamEvents(messages, llm.Options{Cache: time.Hour})
+	first, err := llm.CollectStream(messages, events)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	events, _ = model.StreamEvents(messages, llm.Options{Cache: time.Hour})
+	second, err := llm.CollectStream(messages, events)
+	if err != nil || !second.Cached {
+		t.Fatalf("expected a cache hit, got cached=%v err=%v", second.Cached, err)
+	}
+	last := second.Conversation[len(second.Conversation)-1]
+	if second.Value != first.Value || len(second.Conversation) != len(first.Conversation) || last.ThoughtSignature != "sig" {
+		t.Errorf("expected the replayed conversation to match, got %+v", second.Conversation)
+	}
+	if len(second.Rounds) != 2 || calls != 1 {
+		t.Errorf("expected 2 replayed rounds and 1 tool call, got %d and %d", len(second.Rounds), calls)
+	}
+}
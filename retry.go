@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides if and when a failed prompt is send again.
+// Zero values of MaxAttempts, InitialBackoff, MaxBackoff and Multiplier use the value of DefaultRetryPolicy.
+type RetryPolicy struct {
+	MaxAttempts    int           // Including the first attempt, 1 disables retrying
+	InitialBackoff time.Duration // The wait before the first retry
+	MaxBackoff     time.Duration // The wait between attempts never exceeds this, except when the provider asks for a longer Retry-After
+	Multiplier     float64       // The backoff is multiplied by this after every attempt
+	Jitter         float64       // Fraction of the backoff that is randomized, 0.2 waits between 80% and 120% of the backoff
+	MaxElapsed     time.Duration // Stop retrying when the next attempt would start after this much time, 0 means no limit
+
+	// Retryable reports if an error is worth retrying, defaults to RetryableError
+	Retryable func(err error) bool
+	// IgnoreRetryAfter does not wait for the Retry-After the provider returned
+	IgnoreRetryAfter bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Millisecond * 250,
+	MaxBackoff:     time.Second * 10,
+	Multiplier:     2,
+	Jitter:         0.2,
+	MaxElapsed:     time.Minute * 2,
+}
+
+// NoRetry only tries once
+var NoRetry = &RetryPolicy{MaxAttempts: 1}
+
+// RetryableError reports if sending the same request again might succeed.
+// Errors of the provider API are retried when they are rate limits or server errors,
+// transport failures like timeouts, dropped and refused connections are retried as well.
+// Other errors, like a missing API key, an invalid URL or a bad certificate, are permanent.
+func RetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	if p.Retryable == nil {
+		p.Retryable = RetryableError
+	}
+	return p
+}
+
+// backoff returns how long to wait after the given failed attempt, starting at 1
+func (p RetryPolicy) backoff(attempt int, err error) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	backoff = min(backoff, float64(p.MaxBackoff))
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	wait := time.Duration(backoff)
+
+	var apiErr *APIError
+	if !p.IgnoreRetryAfter && errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+		wait = apiErr.RetryAfter
+	}
+	return wait
+}
+
+// run calls attempt until it succeeds, returns an error that is not retryable or the policy gives up.
+// Waiting between attempts stops as soon as ctx is done.
+func (p RetryPolicy) run(ctx context.Context, attempt func() error) error {
+	p = p.withDefaults()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	start := time.Now()
+	for i := 1; ; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := attempt()
+		if err == nil || i >= p.MaxAttempts || !p.Retryable(err) {
+			return err
+		}
+
+		wait := p.backoff(i, err)
+		if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+// failingProvider fails with the given errors in order before answering
+func failingProvider(errs ...error) *stubProvider {
+	sp := &stubProvider{}
+	sp.promptFn = func(model string, messages []llm.Message, options llm.Options) (llm.Response, error) {
+		if call := int(sp.promptCalls.Load()); call <= len(errs) {
+			return llm.Response{}, errs[call-1]
+		}
+		return okPromptProvider("ok")(model, messages, options)
+	}
+	return sp
+}
+
+func apiError(status int, header http.Header) error {
+	if header == nil {
+		header = http.Header{}
+	}
+	return llm.NewAPIError("stub", &http.Response{StatusCode: status, Header: header}, nil)
+}
+
+var fastRetry = &llm.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestRetry_RetriesRetryableErrors(t *testing.T) {
+	sp := failingProvider(
+		apiError(503, nil),
+		&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET},
+		&url.Error{Op: "Post", URL: "https://api.example.com", Err: os.ErrDeadlineExceeded},
+	)
+	model := &llm.Model{Name: "stub", Provider: sp, Retry: &llm.RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}}
+
+	resp, err := model.PromptSingle("hi", llm.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.Value != "ok" || sp.promptCalls.Load() != 4 {
+		t.Errorf("expected success on the 4th attempt, got %q after %d calls", resp.Value, sp.promptCalls.Load())
+	}
+}
+
+func TestRetry_StopsOnPermanentErrors(t *testing.T) {
+	for _, permanent := range []error{
+		errors.New("missing api key"),
+		&url.Error{Op: "Post", URL: "htps://api.example.com", Err: errors.New(`unsupported protocol scheme "htps"`)},
+	} {
+		sp := failingProvider(permanent)
+		model := &llm.Model{Name: "stub", Provider: sp, Retry: fastRetry}
+		_, err := model.PromptSingle("hi", llm.Options{})
+		if err == nil || sp.promptCalls.Load() != 1 {
+			t.Errorf("expected 1 call for an error that is not a transport failure, got %d calls and %v", sp.promptCalls.Load(), err)
+		}
+	}
+
+	for _, status := range []int{400, 401} {
+		sp := failingProvider(apiError(status, nil))
+		model := &llm.Model{Name: "stub", Provider: sp, Retry: fastRetry}
+
+		_, err := model.PromptSingle("hi", llm.Options{})
+		if err == nil || sp.promptCalls.Load() != 1 {
+			t.Errorf("status %d: expected 1 call and an error, got %d calls and %v", status, sp.promptCalls.Load(), err)
+		}
+	}
+}
+
+func TestRetry_OptionsOverwriteModel(t *testing.T) {
+	sp := failingProvider(apiError(500, nil))
+	model := &llm.Model{Name: "stub", Provider: sp, Retry: fastRetry}
+
+	_, err := model.PromptSingle("hi", llm.Options{Retry: llm.NoRetry})
+	if !errors.Is(err, llm.ErrServer) || sp.promptCalls.Load() != 1 {
+		t.Errorf("expected a single attempt, got %d calls and %v", sp.promptCalls.Load(), err)
+	}
+}
+
+func TestRetry_HonoursRetryAfter(t *testing.T) {
+	sp := failingProvider(apiError(429, http.Header{"Retry-After-Ms": {"50"}}))
+	model := &llm.Model{Name: "stub", Provider: sp, Retry: fastRetry}
+
+	start := time.Now()
+	_, err := model.PromptSingle("hi", llm.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("retried after %v, before the Retry-After of 50ms", elapsed)
+	}
+
+	// A Retry-After beyond MaxElapsed gives up right away
+	sp = failingProvider(apiError(429, http.Header{"Retry-After": {"60"}}))
+	model = &llm.Model{Name: "stub", Provider: sp, Retry: &llm.RetryPolicy{MaxAttempts: 3, MaxElapsed: time.Second}}
+	_, err = model.PromptSingle("hi", llm.Options{})
+	if !errors.Is(err, llm.ErrRateLimited) || sp.promptCalls.Load() != 1 {
+		t.Errorf("expected to give up after 1 call, got %d calls and %v", sp.promptCalls.Load(), err)
+	}
+}
+
+func TestRetry_StopsWaitingOnCancel(t *testing.T) {
+	sp := failingProvider(apiError(503, nil), apiError(503, nil))
+	model := &llm.Model{Name: "stub", Provider: sp, Retry: &llm.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := model.PromptSingle("hi", llm.Options{Ctx: ctx})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("kept sleeping after the context was done")
+	}
+}
+
+// eventStream returns a closed channel with the given events
+func eventStream(events ...llm.StreamEvent) chan llm.StreamEvent {
+	ch := make(chan llm.StreamEvent, len(events))
+	for _, event := range events {
+		ch <- event
+	}
+	close(ch)
+	return ch
+}
+
+func TestRetry_StreamBeforeFirstOutput(t *testing.T) {
+	sp := &stubProvider{}
+	sp.streamFn = func(string, []llm.Message, llm.Options) (chan llm.StreamEvent, error) {
+		switch sp.streamCalls.Load() {
+		case 1:
+			return nil, apiError(429, nil)
+		case 2:
+			return eventStream(llm.StreamEvent{Kind: llm.StreamError, Err: apiError(529, nil)}), nil
+		}
+		return eventStream(
+			llm.StreamEvent{Kind: llm.StreamUsage, Usage: llm.TokenUsage{InputTokens: 3}},
+			llm.StreamEvent{Kind: llm.StreamText, Text: "ok"},
+		), nil
+	}
+	model := &llm.Model{Name: "stub", Provider: sp, Retry: fastRetry}
+
+	events, err := model.StreamEvents([]llm.Message{llm.User("hi")}, llm.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	resp, err := llm.CollectStream(nil, events)
+	if err != nil || resp.Value != "ok" || resp.Usage.InputTokens != 3 {
+		t.Errorf("unexpected response %+v, err %v", resp, err)
+	}
+	if sp.streamCalls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", sp.streamCalls.Load())
+	}
+}
+
+func TestRetry_StreamNotRetriedAfterOutput(t *testing.T) {
+	sp := &stubProvider{}
+	sp.streamFn = func(string, []llm.Message, llm.Options) (chan llm.StreamEvent, error) {
+		return eventStream(
+			llm.StreamEvent{Kind: llm.StreamText, Text: "partial"},
+			llm.StreamEvent{Kind: llm.StreamError, Err: apiError(500, nil)},
+		), nil
+	}
+	model := &llm.Model{Name: "stub", Provider: sp, Retry: fastRetry}
+
+	events, err := model.StreamEvents([]llm.Message{llm.User("hi")}, llm.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	resp, err := llm.CollectStream(nil, events)
+	if !errors.Is(err, llm.ErrServer) || resp.Value != "partial" {
+		t.Errorf("expected the partial answer and the error, got %q and %v", resp.Value, err)
+	}
+	if sp.streamCalls.Load() != 1 {
+		t.Errorf("expected 1 attempt, got %d", sp.streamCalls.Load())
+	}
+
+	// Failing before any output on every attempt is reported inside the stream
+	sp.streamFn = func(string, []llm.Message, llm.Options) (chan llm.StreamEvent, error) {
+		return eventStream(llm.StreamEvent{Kind: llm.StreamError, Err: apiError(500, nil)}), nil
+	}
+	events, err = model.StreamEvents([]llm.Message{llm.User("hi")}, llm.Options{})
+	if err != nil {
+		t.Fatalf("expected the error inside the stream, got %v", err)
+	}
+	if _, err = llm.CollectStream(nil, events); !errors.Is(err, llm.ErrServer) {
+		t.Errorf("expected a server error, got %v", err)
+	}
+}
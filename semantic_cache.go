@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Back-to-code/go-llm/cache"
+)
+
+// Embedder turns text into a vector, used by the semantic cache. ctx is
+// Options.Ctx of the prompt, it is never nil.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// EmbedderFunc allows a function to be used as Embedder
+type EmbedderFunc func(ctx context.Context, text string) ([]float32, error)
+
+func (f EmbedderFunc) Embed(ctx context.Context, text string) ([]float32, error) {
+	return f(ctx, text)
+}
+
+// SemanticCache also returns a cached response when the final user message is worded
+// differently but its embedding has a cosine similarity of at least Threshold with a cached one.
+// All other messages and the options must be the same, like for the exact cache.
+type SemanticCache struct {
+	Embedder  Embedder
+	Index     cache.VectorIndex // Required, NewSemanticCache uses a cache.MemoryIndex
+	Threshold float64           // Defaults to 0.95
+}
+
+func NewSemanticCache(embedder Embedder) *SemanticCache {
+	return &SemanticCache{
+		Embedder: embedder,
+		Index:    cache.NewMemoryIndex(0),
+	}
+}
+
+func (s *SemanticCache) threshold() float64 {
+	if s.Threshold <= 0 {
+		return 0.95
+	}
+	return s.Threshold
+}
+
+// semanticText returns the text of a user message, messages with other parts than text can not be compared
+func semanticText(message Message) (string, bool) {
+	if message.Role != "user" {
+		return "", false
+	}
+	text := []string{message.Content}
+	for _, part := range message.Parts {
+		if part.Type != PartText {
+			return "", false
+		}
+		text = append(text, part.Text)
+	}
+	return strings.TrimSpace(strings.Join(text, "\n")), true
+}
@@ -0,0 +1,222 @@
+package llm
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Back-to-code/go-llm/log"
+)
+
+type StreamEventKind uint8
+
+const (
+	StreamText             StreamEventKind = iota // Text contains a delta of the answer
+	StreamReasoning                               // Text contains a delta of the reasoning / thinking output
+	StreamToolCallStarted                         // ToolCall contains the index, id and name of a new tool call
+	StreamToolCallArgument                        // ToolCall.Arguments contains a delta of the tool call arguments
+	StreamToolCallFinished                        // ToolCall contains the complete tool call
+	StreamUsage                                   // Usage contains the token usage of a round-trip
+	StreamFinish                                  // FinishReason contains the reason the model stopped
+	StreamMessage                                 // Message contains a message added to the conversation, like a tool call or tool result
+	StreamError                                   // Err contains the error that ended the stream, no events follow
+	StreamRound                                   // Round contains the trace of a request, send once its tool calls are resolved
+)
+
+// StreamToolCall describes a (partial) tool call inside a stream
+type StreamToolCall struct {
+	Index     int
+	Id        string
+	Name      string
+	Arguments string
+}
+
+// StreamEvent is a single event emitted by StreamEvents, the Kind decides which other fields are set
+type StreamEvent struct {
+	Kind         StreamEventKind
+	Text         string
+	ToolCall     *StreamToolCall
+	Usage        TokenUsage
+	FinishReason string
+	ResponseId   string     // Set on StreamFinish by providers that store responses
+	StopReason   StopReason // Set on StreamFinish
+	Cached       bool       // Set on StreamFinish when the stream replays a cached response
+	Message      *Message
+	Round        *Round
+	Err          error
+}
+
+// isOutput reports if the event is part of the answer, a stream that fails
+// before its first output event can be started again without the caller noticing
+func (e StreamEvent) isOutput() bool {
+	switch e.Kind {
+	case StreamText, StreamReasoning, StreamToolCallStarted, StreamToolCallArgument, StreamToolCallFinished, StreamMessage:
+		return true
+	}
+	return false
+}
+
+// awaitOutput reads events until the first output event and returns a stream
+// that replays them followed by the remaining events. If the stream fails before
+// any output, the error is returned instead.
+func awaitOutput(events chan StreamEvent) (chan StreamEvent, error) {
+	var buffered []StreamEvent
+	for event := range events {
+		if event.Kind == StreamError {
+			go func() {
+				for range events {
+				}
+			}()
+			if event.Err == nil {
+				return nil, errors.New("stream failed")
+			}
+			return nil, event.Err
+		}
+
+		buffered = append(buffered, event)
+		if event.isOutput() {
+			return replayStream(buffered, events), nil
+		}
+	}
+	return replayStream(buffered, nil), nil
+}
+
+// replayStream returns a stream of the buffered events followed by the events of rest, rest may be nil
+func replayStream(buffered []StreamEvent, rest chan StreamEvent) chan StreamEvent {
+	events := make(chan StreamEvent, len(buffered))
+	for _, event := range buffered {
+		events <- event
+	}
+	if rest == nil {
+		close(events)
+		return events
+	}
+
+	go func() {
+		defer close(events)
+		for event := range rest {
+			events <- event
+		}
+	}()
+	return events
+}
+
+// errorStream returns a stream with only the error event
+func errorStream(err error) chan StreamEvent {
+	return replayStream([]StreamEvent{{Kind: StreamError, Err: err}}, nil)
+}
+
+// TextStream converts an event stream into a stream of text deltas, the old
+// Stream behavior. Errors are logged as the string channel cannot carry them.
+func TextStream(events chan StreamEvent) chan string {
+	textChannel := make(chan string)
+	go func() {
+		defer close(textChannel)
+		for event := range events {
+			switch event.Kind {
+			case StreamText:
+				textChannel <- event.Text
+			case StreamError:
+				if event.Err == nil {
+					log.Info("stream failed")
+					continue
+				}
+				log.Info("stream failed: " + event.Err.Error())
+			}
+		}
+	}()
+	return textChannel
+}
+
+// CollectStream reads all events and combines them into a Response like the
+// one returned by Prompt. messages should be the messages the stream was
+// started with. If the stream reports an error, the partial response is
+// returned alongside the error.
+func CollectStream(messages []Message, events chan StreamEvent) (Response, error) {
+	collector := newStreamCollector(messages)
+	for event := range events {
+		collector.add(event)
+	}
+	return collector.response(), collector.err
+}
+
+// streamCollector combines stream events into a Response
+type streamCollector struct {
+	conversation []Message
+	value        strings.Builder
+	reasoning    strings.Builder
+	usage        TokenUsage
+	responseId   string
+	stopReason   StopReason
+	rounds       []Round
+	answered     bool // The final assistant message was received as a StreamMessage
+	finished     bool // A StreamFinish event was received
+	cached       bool
+	err          error
+}
+
+func newStreamCollector(messages []Message) *streamCollector {
+	conversation := make([]Message, len(messages))
+	copy(conversation, messages)
+	return &streamCollector{conversation: conversation}
+}
+
+func (c *streamCollector) add(event StreamEvent) {
+	switch event.Kind {
+	case StreamText:
+		c.value.WriteString(event.Text)
+	case StreamReasoning:
+		c.reasoning.WriteString(event.Text)
+	case StreamFinish:
+		c.finished = true
+		c.cached = c.cached || event.Cached
+		if event.StopReason != "" {
+			c.stopReason = event.StopReason
+		}
+		if event.ResponseId != "" {
+			c.responseId = event.ResponseId
+		}
+	case StreamMessage:
+		// Text streamed before a tool call is part of the tool call message,
+		// the text of the answer is part of the final message
+		c.conversation = append(c.conversation, *event.Message)
+		c.value.Reset()
+		c.answered = event.Message.Role == "assistant" && len(event.Message.ToolCalls) == 0
+	case StreamRound:
+		c.rounds = append(c.rounds, *event.Round)
+	case StreamUsage:
+		c.usage.InputTokens += event.Usage.InputTokens
+		c.usage.OutputTokens += event.Usage.OutputTokens
+		c.usage.CachedInputTokens += event.Usage.CachedInputTokens
+	case StreamError:
+		c.err = event.Err
+		if c.err == nil {
+			c.err = errors.New("stream failed")
+		}
+	}
+}
+
+func (c *streamCollector) response() Response {
+	value := c.value.String()
+	conversation := c.conversation
+	switch {
+	case c.stopReason == StopMaxToolRounds:
+		// Like ToolLoop.Run, the text of the message with the unresolved tool calls is dropped
+		value = ""
+	case c.answered:
+		// The message of the tool loop also has the reasoning and thought signature
+		value = conversation[len(conversation)-1].Content
+	default:
+		conversation = append(conversation, Assistant(value))
+	}
+
+	return Response{
+		Value:        value,
+		Conversation: conversation,
+		Usage:        c.usage,
+		Id:           c.responseId,
+		Reasoning:    c.reasoning.String(),
+		StopReason:   c.stopReason,
+		Rounds:       c.rounds,
+		Cached:       c.cached,
+	}
+}
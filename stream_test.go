@@ -0,0 +1,22 @@
+package llm_test
+
+import (
+	"testing"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+func TestTextStreamErrorWithoutErr(t *testing.T) {
+	text := llm.TextStream(eventStream(
+		llm.StreamEvent{Kind: llm.StreamText, Text: "partial"},
+		llm.StreamEvent{Kind: llm.StreamError},
+	))
+
+	var got string
+	for delta := range text {
+		got += delta
+	}
+	if got != "partial" {
+		t.Errorf("expected the text before the error, got %q", got)
+	}
+}
@@ -0,0 +1,82 @@
+package togetherai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+// Test the tool loop sends the resolver output back to the model, accumulates
+// the usage including cached tokens and toggles reasoning for hybrid models.
+func TestPromptToolsAndUsage(t *testing.T) {
+	os.Setenv("TOGETHER_AI_TOKEN", "test-token")
+	defer os.Unsetenv("TOGETHER_AI_TOKEN")
+
+	type request struct {
+		Messages []struct {
+			Role       string `json:"role"`
+			Content    string `json:"content"`
+			ToolCallId string `json:"tool_call_id"`
+		} `json:"messages"`
+		Reasoning *Reasoning `json:"reasoning"`
+	}
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Amsterdam\"}"}}]}}],"usage":{"prompt_tokens":10,"completion_tokens":5,"cached_tokens":4}}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"sunny"}}],"usage":{"prompt_tokens":20,"completion_tokens":2,"cached_tokens":8}}`))
+	}))
+	defer server.Close()
+
+	prev := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = prev }()
+
+	var gotArgs string
+	tools := []llm.Tool{{
+		Type:     "function",
+		Function: llm.FunctionDef{Name: "get_weather"},
+		Resolver: func(args json.RawMessage) (any, error) {
+			gotArgs = string(args)
+			return "sunny", nil
+		},
+	}}
+
+	p := &Provider{}
+	resp, err := p.Prompt("Qwen/Qwen3.5-9B", []llm.Message{llm.User("weather?")}, llm.Options{Tools: tools})
+	if err != nil {
+		t.Fatalf("Prompt returned error: %v", err)
+	}
+	if resp.Value != "sunny" {
+		t.Errorf("Prompt returned %q, want %q", resp.Value, "sunny")
+	}
+	if gotArgs != `{"city":"Amsterdam"}` {
+		t.Errorf("wrong args threaded to resolver: %q", gotArgs)
+	}
+	want := llm.TokenUsage{InputTokens: 30, OutputTokens: 7, CachedInputTokens: 12}
+	if resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	followUp := requests[1].Messages
+	if last := followUp[len(followUp)-1]; last.Role != "tool" || last.ToolCallId != "call_1" || last.Content != `"sunny"` {
+		t.Errorf("unexpected tool message %+v", last)
+	}
+	if requests[0].Reasoning == nil || requests[0].Reasoning.Enabled {
+		t.Errorf("expected reasoning to be disabled for NoThinking, got %+v", requests[0].Reasoning)
+	}
+}
@@ -0,0 +1,53 @@
+package togetherai
+
+import (
+	"strings"
+
+	"github.com/Back-to-code/go-llm"
+)
+
+type Reasoning struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Models that accept a reasoning effort
+var reasoningEffortModels = []string{
+	"openai/gpt-oss",
+}
+
+// Hybrid models where thinking can only be turned on or off
+var reasoningToggleModels = []string{
+	"deepseek-ai/deepseek-v3.1",
+	"deepseek-ai/deepseek-v3.2",
+	"qwen/qwen3.5",
+	"zai-org/glm-4",
+	"moonshotai/kimi-k2.5",
+}
+
+// reasoningParams returns the reasoning_effort or reasoning value for a model, models that do not reason return neither
+func reasoningParams(model string, thinking llm.Thinking) (string, *Reasoning) {
+	model = strings.ToLower(model)
+
+	for _, modelNamePrefix := range reasoningEffortModels {
+		if !strings.HasPrefix(model, modelNamePrefix) {
+			continue
+		}
+
+		switch thinking {
+		case llm.NoThinking, llm.MinimalThinking, llm.LowThinking:
+			return "low", nil
+		case llm.MediumThinking:
+			return "medium", nil
+		case llm.HighThinking:
+			return "high", nil
+		}
+	}
+
+	for _, modelNamePrefix := range reasoningToggleModels {
+		if strings.HasPrefix(model, modelNamePrefix) {
+			return "", &Reasoning{Enabled: thinking > llm.MinimalThinking}
+		}
+	}
+
+	return "", nil
+}
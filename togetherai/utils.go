@@ -0,0 +1,34 @@
+package togetherai
+
+import (
+	"github.com/Back-to-code/go-llm"
+	apikey "github.com/Back-to-code/go-llm/apikeys"
+	"github.com/Back-to-code/go-llm/openai"
+)
+
+// BaseURL is the Together AI API base URL. Exported for test overrides.
+var BaseURL = "https://api.together.xyz"
+
+// compatible returns the OpenAI compatible provider for the Together AI API,
+// it is created for every request so changes to BaseURL are picked up
+func compatible() *openai.Compatible {
+	return openai.NewCompatible(openai.Config{
+		Name:          "togetherai",
+		BaseURL:       BaseURL,
+		ApiKey:        apikey.TogetherAi,
+		StringContent: true,
+		Parts:         []llm.PartType{llm.PartImage},
+		ReasoningEffort: func(model string, thinking llm.Thinking) string {
+			effort, _ := reasoningParams(model, thinking)
+			return effort
+		},
+		Reasoning: func(model string, thinking llm.Thinking) any {
+			// A nil *Reasoning in an interface is not omitted, so return an untyped nil
+			if _, reasoning := reasoningParams(model, thinking); reasoning != nil {
+				return reasoning
+			}
+			return nil
+		},
+		ReasoningWithTools: true,
+	})
+}
@@ -1,21 +1,159 @@
 package llm
 
-import "encoding/json"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
 
 type FunctionDef struct {
-	Name                 string          `json:"name"`
-	Description          string          `json:"description,omitempty"`
-	Parameters           json.RawMessage `json:"parameters,omitempty"`
-	AdditionalProperties bool            `json:"additionalProperties"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      bool            `json:"strict,omitempty"` // The model must follow Parameters exactly, see JsonSchema.Strict
+
+	// Deprecated: was send as a stray key of the function object, set
+	// additionalProperties in Parameters instead.
+	AdditionalProperties bool `json:"-"`
 }
 
 // Tool defines a tool that can be used by the LLM
-// Required fields are Resolver and Function
-// The contents of "Function" can be created via the openai website
+// Required fields are Resolver (or ContextResolver) and Function
+// The contents of "Function" can be created via the openai website, or use NewTool to derive them from a Go function
+//
+// Built-in tools that run at the provider, like "web_search" of the openai
+// Responses provider, only need a Type and optionally Params.
 type Tool struct {
-	Resolver func(json.RawMessage) (any, error) `json:"-"`
+	Resolver        func(json.RawMessage) (any, error) `json:"-"`
+	ContextResolver ContextResolver                    `json:"-"` // Used instead of Resolver if set
+	Timeout         time.Duration                      `json:"-"` // The maximum time the resolver may take, 0 means no limit
 
 	Type     string      `json:"type"` // Automatically set to "function" if empty
 	Function FunctionDef `json:"function"`
-	Strict   bool        `json:"strict"`
+
+	// Deprecated: use Function.Strict, Strict is copied to it when the prompt is send.
+	Strict bool `json:"-"`
+
+	Params map[string]any `json:"-"` // Extra fields of a built-in tool, like vector_store_ids for file_search
+}
+
+// ToolCallInfo describes the tool call a resolver is called for
+type ToolCallInfo struct {
+	Id           string
+	Name         string
+	Conversation []Message // A copy of the conversation up to and including the assistant message with the tool call
+}
+
+// ContextResolver resolves a tool call, ctx is cancelled when the prompt is cancelled or Tool.Timeout passed
+type ContextResolver func(ctx context.Context, call ToolCallInfo, arguments json.RawMessage) (any, error)
+
+// contextResolver returns ContextResolver, or an adapter for Resolver
+func (t Tool) contextResolver() ContextResolver {
+	if t.ContextResolver != nil {
+		return t.ContextResolver
+	}
+	if t.Resolver == nil {
+		return nil
+	}
+	return func(_ context.Context, _ ToolCallInfo, arguments json.RawMessage) (any, error) {
+		return t.Resolver(arguments)
+	}
+}
+
+type ToolChoiceMode string
+
+const (
+	ToolChoiceAuto     ToolChoiceMode = "auto"     // The model decides if it calls tools
+	ToolChoiceNone     ToolChoiceMode = "none"     // The model does not call tools
+	ToolChoiceRequired ToolChoiceMode = "required" // The model calls at least one tool
+	ToolChoiceFunction ToolChoiceMode = "function" // The model calls the tool named ToolChoice.Function
+)
+
+// ToolChoice controls if and which tools the model calls, the zero value lets the model decide.
+// A forced tool call only applies to the first round, after the tool results the model can answer.
+type ToolChoice struct {
+	Mode     ToolChoiceMode // Defaults to ToolChoiceAuto
+	Function string         // The name of the tool to call, only for ToolChoiceFunction
+}
+
+// CallTool returns a ToolChoice that forces the model to call the named tool
+func CallTool(name string) ToolChoice {
+	return ToolChoice{Mode: ToolChoiceFunction, Function: name}
+}
+
+// Forced reports if the model must call a tool
+func (c ToolChoice) Forced() bool {
+	return c.Mode == ToolChoiceRequired || c.Mode == ToolChoiceFunction
+}
+
+// NewTool creates a tool that calls fn. The parameter schema is derived from
+// Args like JsonSchemaFor, including the description, enum, required, min and
+// max tags. The arguments of a call are validated and decoded before fn is
+// called, invalid arguments are reported to the model so it can try again.
+func NewTool[Args any, Result any](name string, description string, fn func(ctx context.Context, args Args) (Result, error)) (Tool, error) {
+	schema, node, err := jsonSchemaForType(reflect.TypeFor[Args]())
+	if err != nil {
+		return Tool{}, fmt.Errorf("tool %s: %w", name, err)
+	}
+
+	return Tool{
+		Type: "function",
+		Function: FunctionDef{
+			Name:        name,
+			Description: description,
+			Parameters:  schema.Schema,
+			Strict:      schema.Strict,
+		},
+		Strict: schema.Strict, // For callers that still read the deprecated field
+		ContextResolver: func(ctx context.Context, _ ToolCallInfo, arguments json.RawMessage) (any, error) {
+			if len(arguments) == 0 || string(arguments) == "null" {
+				// Some models leave out the arguments of a tool without parameters
+				arguments = json.RawMessage("{}")
+			}
+
+			var args Args
+			err := decodeAndValidate(node, arguments, &args)
+			if err != nil {
+				return nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+			return fn(ctx, args)
+		},
+	}, nil
+}
+
+// MustNewTool is like NewTool but panics if the schema can not be derived from Args
+func MustNewTool[Args any, Result any](name string, description string, fn func(ctx context.Context, args Args) (Result, error)) Tool {
+	tool, err := NewTool(name, description, fn)
+	if err != nil {
+		panic(err)
+	}
+	return tool
+}
+
+// IsFunction returns true for tools that are resolved locally
+func (t Tool) IsFunction() bool {
+	return t.Type == "" || t.Type == "function"
+}
+
+// NewToolCallId generates an id for providers that do not identify tool calls
+func NewToolCallId() string {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return "call_" + hex.EncodeToString(id)
+}
+
+// ToolCallNames maps the ids of all tool calls in the conversation to the name
+// of the called tool, for providers that match tool results by name
+func ToolCallNames(messages []Message) map[string]string {
+	names := map[string]string{}
+	for _, message := range messages {
+		for _, toolCall := range message.ToolCalls {
+			names[toolCall.Id] = toolCall.Name
+		}
+	}
+	return names
 }
@@ -0,0 +1,318 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Back-to-code/go-llm/log"
+)
+
+// DefaultMaxToolRounds is used when Options.MaxToolRounds is not set
+var DefaultMaxToolRounds = 20
+
+type StopReason string
+
+const (
+	StopCompleted     StopReason = "completed"       // The model finished its answer
+	StopMaxTokens     StopReason = "max_tokens"      // The answer was cut off at Options.MaxTokens
+	StopMaxToolRounds StopReason = "max_tool_rounds" // The model still wanted to call tools after Options.MaxToolRounds rounds
+	StopContentFilter StopReason = "content_filter"  // The answer was cut off by a content filter
+)
+
+// Round describes a single request to the model, a prompt that calls tools has a round for every time tools were called
+type Round struct {
+	Usage        TokenUsage
+	FinishReason string        // The finish reason as reported by the provider
+	Duration     time.Duration // How long the request took, without resolving the tool calls
+	ToolCalls    []ToolCall
+	ToolResults  []Message // The tool messages with the results of ToolCalls
+}
+
+// RoundResult is the answer of the model to a single request inside a ToolLoop
+type RoundResult struct {
+	Message      Message // The assistant message, it has ToolCalls when the model wants to call tools
+	Usage        TokenUsage
+	StopReason   StopReason // Defaults to StopCompleted
+	FinishReason string     // The finish reason as reported by the provider
+	Id           string     // The response id for providers that store responses
+	Reasoning    string     // The reasoning (summary) text
+}
+
+// ToolLoop sends the conversation to the model until it stops calling tools,
+// providers only implement a single request in Round.
+type ToolLoop struct {
+	Options Options
+	// Round sends the messages to the model and returns its answer. The options
+	// start as Options, a forced ToolChoice is reset after the first tool calls
+	// and PreviousResponseId is chained to the Id of the previous round.
+	Round func(messages []Message, options Options) (RoundResult, error)
+	// OnMessage is called for every message added to the conversation for a tool call, optional
+	OnMessage func(message Message)
+	// OnRound is called with the trace of every round once its tool calls are resolved, optional
+	OnRound func(round Round)
+}
+
+// Run calls Round until the model answers without tool calls or the maximum number of tool rounds is reached.
+// When the maximum is reached the last assistant message with the unresolved tool calls is not added to the conversation
+// and Value is empty.
+func (l ToolLoop) Run(messages []Message) (Response, error) {
+	options := l.Options
+	maxToolRounds := options.MaxToolRounds
+	if maxToolRounds <= 0 {
+		maxToolRounds = DefaultMaxToolRounds
+	}
+
+	// The conversation is extended, so do not modify the slice of the caller
+	messages = append([]Message{}, messages...)
+
+	var resp Response
+	for toolRounds := 0; ; toolRounds++ {
+		start := time.Now()
+		result, err := l.Round(messages, options)
+		if err != nil {
+			return Response{}, err
+		}
+
+		round := Round{
+			Usage:        result.Usage,
+			FinishReason: result.FinishReason,
+			Duration:     time.Since(start),
+			ToolCalls:    result.Message.ToolCalls,
+		}
+		resp.Usage.InputTokens += result.Usage.InputTokens
+		resp.Usage.OutputTokens += result.Usage.OutputTokens
+		resp.Usage.CachedInputTokens += result.Usage.CachedInputTokens
+		resp.Value = result.Message.Content
+		resp.Id = result.Id
+		resp.Reasoning += result.Reasoning
+		resp.StopReason = result.StopReason
+		if resp.StopReason == "" {
+			resp.StopReason = StopCompleted
+		}
+
+		if len(result.Message.ToolCalls) == 0 {
+			resp.Rounds = append(resp.Rounds, round)
+			l.onRound(round)
+			resp.Conversation = append(messages, result.Message)
+			return resp, nil
+		}
+		if toolRounds >= maxToolRounds {
+			log.Info("llm stopped after the maximum of tool rounds")
+			resp.Rounds = append(resp.Rounds, round)
+			l.onRound(round)
+			resp.Conversation = messages
+			resp.Value = ""
+			resp.StopReason = StopMaxToolRounds
+			return resp, nil
+		}
+
+		messages = append(messages, result.Message)
+		l.onMessage(result.Message)
+
+		round.ToolResults = ResolveToolCalls(messages, options)
+		if options.Ctx != nil && options.Ctx.Err() != nil {
+			// The resolvers were cancelled with the prompt
+			return Response{}, options.Ctx.Err()
+		}
+		for _, message := range round.ToolResults {
+			messages = append(messages, message)
+			l.onMessage(message)
+		}
+		resp.Rounds = append(resp.Rounds, round)
+		l.onRound(round)
+
+		if options.ToolChoice.Forced() {
+			// Otherwise the model could never answer
+			options.ToolChoice = ToolChoice{}
+		}
+		if options.PreviousResponseId != "" {
+			// Keep chaining, the tool calls are part of this response
+			options.PreviousResponseId = result.Id
+		}
+	}
+}
+
+func (l ToolLoop) onMessage(message Message) {
+	if l.OnMessage != nil {
+		l.OnMessage(message)
+	}
+}
+
+func (l ToolLoop) onRound(round Round) {
+	if l.OnRound != nil {
+		l.OnRound(round)
+	}
+}
+
+// Stream runs the loop for a stream, Round is expected to send the events of
+// the answer. The tool messages and the final assistant message are send as
+// StreamMessage events, the rounds as StreamRound events and errors as a
+// StreamError event. The events channel is closed when done.
+func (l ToolLoop) Stream(messages []Message, events chan StreamEvent) {
+	defer close(events)
+
+	l.OnMessage = func(message Message) {
+		events <- StreamEvent{Kind: StreamMessage, Message: &message}
+	}
+	l.OnRound = func(round Round) {
+		events <- StreamEvent{Kind: StreamRound, Round: &round}
+	}
+	resp, err := l.Run(messages)
+	if err != nil {
+		events <- StreamEvent{Kind: StreamError, Err: err}
+		return
+	}
+	if resp.StopReason == StopMaxToolRounds {
+		events <- StreamEvent{Kind: StreamFinish, FinishReason: string(StopMaxToolRounds), StopReason: StopMaxToolRounds}
+		return
+	}
+	// The streamed text misses the reasoning and thought signature of the message
+	events <- StreamEvent{Kind: StreamMessage, Message: &resp.Conversation[len(resp.Conversation)-1]}
+}
+
+// StreamToolLoop runs a ToolLoop for a stream where every round is a streamed
+// request. first is the response body of the first request, which is send
+// before so connection errors can be returned directly. open sends the
+// requests of the following rounds and read forwards a response body as
+// events and returns the round. The bodies are closed after reading.
+func StreamToolLoop(
+	first io.ReadCloser,
+	messages []Message,
+	options Options,
+	open func(messages []Message, options Options) (io.ReadCloser, error),
+	read func(body io.Reader, events chan StreamEvent) (RoundResult, error),
+) chan StreamEvent {
+	events := make(chan StreamEvent)
+	body := first
+	go ToolLoop{
+		Options: options,
+		Round: func(messages []Message, options Options) (RoundResult, error) {
+			if body == nil {
+				var err error
+				body, err = open(messages, options)
+				if err != nil {
+					return RoundResult{}, err
+				}
+			}
+			defer func() {
+				body.Close()
+				body = nil
+			}()
+			return read(body, events)
+		},
+	}.Stream(messages, events)
+	return events
+}
+
+// ResolveToolCalls runs the resolvers of the tool calls in the last message of
+// the conversation and returns the tool messages with their results in the
+// order of the calls, errors and timeouts are reported to the model as the
+// result. Up to Options.ToolConcurrency resolvers run at the same time.
+func ResolveToolCalls(conversation []Message, options Options) []Message {
+	if len(conversation) == 0 {
+		return nil
+	}
+	toolCalls := conversation[len(conversation)-1].ToolCalls
+	ctx := options.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	results := make([]Message, len(toolCalls))
+	resolve := func(idx int) {
+		results[idx] = Message{
+			Role:       "tool",
+			Content:    resolveToolCall(ctx, toolCalls[idx], conversation, options.Tools),
+			ToolCallId: toolCalls[idx].Id,
+		}
+	}
+
+	if options.ToolConcurrency <= 1 || len(toolCalls) <= 1 {
+		for idx := range toolCalls {
+			resolve(idx)
+		}
+		return results
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, options.ToolConcurrency)
+	for idx := range toolCalls {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			resolve(idx)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func resolveToolCall(ctx context.Context, toolCall ToolCall, conversation []Message, tools []Tool) string {
+	log.Info("llm tool call " + toolCall.Name)
+
+	var matched *Tool
+	for idx, tool := range tools {
+		if tool.IsFunction() && tool.Function.Name == toolCall.Name {
+			matched = &tools[idx]
+			break
+		}
+	}
+	if matched == nil {
+		return "error: not found"
+	}
+
+	arguments := json.RawMessage(toolCall.Arguments)
+	if !json.Valid(arguments) {
+		arguments = json.RawMessage("null")
+	}
+
+	parent := ctx
+	if matched.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, matched.Timeout)
+		defer cancel()
+	}
+
+	type resolved struct {
+		response any
+		err      error
+	}
+	// Buffered so a resolver that ignores ctx can still finish after the timeout
+	done := make(chan resolved, 1)
+	go func() {
+		response, err := matched.contextResolver()(ctx, ToolCallInfo{
+			Id:           toolCall.Id,
+			Name:         toolCall.Name,
+			Conversation: slices.Clone(conversation),
+		}, arguments)
+		done <- resolved{response, err}
+	}()
+
+	var result resolved
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result.err = ctx.Err()
+	}
+	if result.err != nil && parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "error: timed out after " + matched.Timeout.String()
+	}
+	if result.err != nil {
+		return "error: " + result.err.Error()
+	}
+
+	responseJson, err := json.Marshal(result.response)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return string(responseJson)
+}
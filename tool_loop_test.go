@@ -0,0 +1,405 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+// loopTool is a tool that counts how often it is resolved
+func loopTool(calls *int) llm.Tool {
+	return llm.Tool{
+		Type:     "function",
+		Function: llm.FunctionDef{Name: "lookup"},
+		Resolver: func(json.RawMessage) (any, error) {
+			*calls++
+			return "found", nil
+		},
+	}
+}
+
+func toolCallRound(id string) llm.RoundResult {
+	return llm.RoundResult{
+		Message: llm.Message{Role: "assistant", ToolCalls: []llm.ToolCall{{Id: id, Name: "lookup", Arguments: `{}`}}},
+		Usage:   llm.TokenUsage{InputTokens: 10, OutputTokens: 1},
+	}
+}
+
+func TestToolLoopRun(t *testing.T) {
+	calls := 0
+	var seen [][]llm.Message
+	loop := llm.ToolLoop{
+		Options: llm.Options{Tools: []llm.Tool{loopTool(&calls)}},
+		Round: func(messages []llm.Message, _ llm.Options) (llm.RoundResult, error) {
+			seen = append(seen, messages)
+			if len(seen) == 1 {
+				return toolCallRound("call_1"), nil
+			}
+			return llm.RoundResult{Message: llm.Assistant("done"), Usage: llm.TokenUsage{InputTokens: 20}}, nil
+		},
+	}
+
+	messages := []llm.Message{llm.User("hi")}
+	resp, err := loop.Run(messages)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Value != "done" || calls != 1 {
+		t.Errorf("expected the answer after 1 tool call, got %q after %d calls", resp.Value, calls)
+	}
+	if resp.Usage.InputTokens != 30 {
+		t.Errorf("expected the usage of both rounds, got %d input tokens", resp.Usage.InputTokens)
+	}
+	if len(seen[1]) != 3 || seen[1][2].Content != `"found"` || seen[1][2].ToolCallId != "call_1" {
+		t.Errorf("expected the tool result in the second round, got %+v", seen[1])
+	}
+	if len(resp.Conversation) != 4 || len(messages) != 1 {
+		t.Errorf("expected 4 messages without changing the messages of the caller, got %+v", resp.Conversation)
+	}
+}
+
+func TestToolLoopStopsAtMaxToolRounds(t *testing.T) {
+	calls := 0
+	rounds := 0
+	loop := llm.ToolLoop{
+		Options: llm.Options{Tools: []llm.Tool{loopTool(&calls)}, MaxToolRounds: 2},
+		Round: func(messages []llm.Message, _ llm.Options) (llm.RoundResult, error) {
+			rounds++
+			round := toolCallRound("call")
+			round.Message.Content = "Let me look that up"
+			return round, nil
+		},
+	}
+
+	resp, err := loop.Run([]llm.Message{llm.User("hi")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StopReason != llm.StopMaxToolRounds {
+		t.Errorf("expected stop reason %q, got %q", llm.StopMaxToolRounds, resp.StopReason)
+	}
+	if rounds != 3 || calls != 2 {
+		t.Errorf("expected 3 rounds and 2 resolved calls, got %d and %d", rounds, calls)
+	}
+	if len(resp.Rounds) != 3 || resp.Usage.InputTokens != 30 {
+		t.Errorf("expected a trace of 3 rounds with summed usage, got %d rounds and %d input tokens", len(resp.Rounds), resp.Usage.InputTokens)
+	}
+	// The unresolved tool calls of the last round are not part of the conversation
+	last := resp.Conversation[len(resp.Conversation)-1]
+	if last.Role != "tool" || len(resp.Conversation) != 5 {
+		t.Errorf("expected the conversation to end with a tool result, got %+v", resp.Conversation)
+	}
+	if resp.Value != "" {
+		t.Errorf("expected no value without an answer, got %q", resp.Value)
+	}
+}
+
+func TestToolLoopTracesRounds(t *testing.T) {
+	calls := 0
+	var seen [][]llm.Message
+	loop := llm.ToolLoop{
+		Options: llm.Options{Tools: []llm.Tool{loopTool(&calls)}},
+		Round: func(messages []llm.Message, _ llm.Options) (llm.RoundResult, error) {
+			seen = append(seen, messages)
+			if len(seen) == 1 {
+				return toolCallRound("call_1"), nil
+			}
+			return llm.RoundResult{
+				Message:      llm.Assistant("done"),
+				StopReason:   llm.StopMaxTokens,
+				FinishReason: "length",
+			}, nil
+		},
+	}
+
+	resp, err := loop.Run([]llm.Message{llm.User("hi")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Value != "done" || resp.StopReason != llm.StopMaxTokens {
+		t.Errorf("expected the final answer and its stop reason, got %q and %q", resp.Value, resp.StopReason)
+	}
+	if len(seen[1]) != 3 || seen[1][2].Content != `"found"` || seen[1][2].ToolCallId != "call_1" {
+		t.Errorf("expected the tool result in the second round, got %+v", seen[1])
+	}
+	if len(resp.Rounds) != 2 {
+		t.Fatalf("expected 2 rounds, got %d", len(resp.Rounds))
+	}
+	if len(resp.Rounds[0].ToolCalls) != 1 || len(resp.Rounds[0].ToolResults) != 1 {
+		t.Errorf("expected the first round to hold the tool call and result, got %+v", resp.Rounds[0])
+	}
+	if resp.Rounds[1].FinishReason != "length" {
+		t.Errorf("expected the finish reason of the provider, got %q", resp.Rounds[1].FinishReason)
+	}
+}
+
+func TestToolLoopStream(t *testing.T) {
+	calls := 0
+	events := make(chan llm.StreamEvent)
+	go llm.ToolLoop{
+		Options: llm.Options{Tools: []llm.Tool{loopTool(&calls)}, MaxToolRounds: 1},
+		Round: func(messages []llm.Message, _ llm.Options) (llm.RoundResult, error) {
+			events <- llm.StreamEvent{Kind: llm.StreamText, Text: "Let me look that up"}
+			return toolCallRound("call"), nil
+		},
+	}.Stream([]llm.Message{llm.User("hi")}, events)
+
+	resp, err := llm.CollectStream([]llm.Message{llm.User("hi")}, events)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StopReason != llm.StopMaxToolRounds || calls != 1 {
+		t.Errorf("expected to stop after 1 tool round, got %q after %d calls", resp.StopReason, calls)
+	}
+	// The tool call and its result are send as messages, like Run the conversation ends with the tool result
+	if len(resp.Conversation) != 3 || resp.Conversation[2].Role != "tool" || resp.Value != "" {
+		t.Errorf("expected 3 messages and no value, got %q and %+v", resp.Value, resp.Conversation)
+	}
+}
+
+// closeCounter is a response body that counts how often it is closed
+type closeCounter struct {
+	io.Reader
+	closed *int
+}
+
+func (c closeCounter) Close() error {
+	*c.closed++
+	return nil
+}
+
+func TestStreamToolLoop(t *testing.T) {
+	calls, closed := 0, 0
+	var opened []string
+	open := func(messages []llm.Message, _ llm.Options) (io.ReadCloser, error) {
+		opened = append(opened, messages[len(messages)-1].Content)
+		return closeCounter{strings.NewReader("answer"), &closed}, nil
+	}
+	read := func(body io.Reader, events chan llm.StreamEvent) (llm.RoundResult, error) {
+		content, _ := io.ReadAll(body)
+		if string(content) == "first" {
+			return toolCallRound("call"), nil
+		}
+		events <- llm.StreamEvent{Kind: llm.StreamText, Text: string(content)}
+		return llm.RoundResult{Message: llm.Assistant(string(content))}, nil
+	}
+
+	messages := []llm.Message{llm.User("hi")}
+	first := closeCounter{strings.NewReader("first"), &closed}
+	events := llm.StreamToolLoop(first, messages, llm.Options{Tools: []llm.Tool{loopTool(&calls)}}, open, read)
+
+	resp, err := llm.CollectStream(messages, events)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Value != "answer" || calls != 1 {
+		t.Errorf("expected the answer after 1 tool call, got %q after %d calls", resp.Value, calls)
+	}
+	// The tool call and its result are send as messages
+	if len(resp.Conversation) != 4 {
+		t.Errorf("expected 4 messages, got %+v", resp.Conversation)
+	}
+	// Only the second round opens a request, with the tool result
+	if len(opened) != 1 || opened[0] != `"found"` || closed != 2 {
+		t.Errorf("expected 1 opened request and 2 closed bodies, got %q and %d", opened, closed)
+	}
+}
+
+// answerLoop calls the lookup tool once and then answers with a thought signature
+func answerLoop(calls *int, events chan llm.StreamEvent) llm.ToolLoop {
+	return llm.ToolLoop{
+		Options: llm.Options{Tools: []llm.Tool{loopTool(calls)}},
+		Round: func(messages []llm.Message, _ llm.Options) (llm.RoundResult, error) {
+			if len(messages) == 1 {
+				return toolCallRound("call"), nil
+			}
+			events <- llm.StreamEvent{Kind: llm.StreamText, Text: "found it"}
+			events <- llm.StreamEvent{Kind: llm.StreamFinish, FinishReason: "stop"}
+			return llm.RoundResult{
+				Message: llm.Message{Role: "assistant", Content: "found it", Reasoning: json.RawMessage(`[{"type":"reasoning"}]`), ThoughtSignature: "sig"},
+				Usage:   llm.TokenUsage{InputTokens: 20, OutputTokens: 2},
+			}, nil
+		},
+	}
+}
+
+func TestToolLoopStreamFinalMessage(t *testing.T) {
+	calls := 0
+	events := make(chan llm.StreamEvent)
+	go answerLoop(&calls, events).Stream([]llm.Message{llm.User("hi")}, events)
+
+	resp, err := llm.CollectStream([]llm.Message{llm.User("hi")}, events)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	last := resp.Conversation[len(resp.Conversation)-1]
+	if resp.Value != "found it" || len(resp.Conversation) != 4 || last.ThoughtSignature != "sig" || len(last.Reasoning) == 0 {
+		t.Errorf("expected the final message of the loop, got %q and %+v", resp.Value, resp.Conversation)
+	}
+	if len(resp.Rounds) != 2 || len(resp.Rounds[0].ToolResults) != 1 || resp.Rounds[1].Usage.InputTokens != 20 {
+		t.Errorf("expected the trace of 2 rounds, got %+v", resp.Rounds)
+	}
+}
+
+func TestToolChoiceMustMatchATool(t *testing.T) {
+	calls := 0
+	sp := &stubProvider{promptFn: okPromptProvider("ok")}
+	model := &llm.Model{Name: "stub", Provider: sp}
+
+	_, err := model.Prompt([]llm.Message{llm.User("hi")}, llm.Options{Tools: []llm.Tool{loopTool(&calls)}, ToolChoice: llm.CallTool("missing"), Retry: llm.NoRetry})
+	if err == nil || sp.promptCalls.Load() != 0 {
+		t.Errorf("expected an error before prompting, got %v", err)
+	}
+	_, err = model.Prompt([]llm.Message{llm.User("hi")}, llm.Options{Tools: []llm.Tool{loopTool(&calls)}, ToolChoice: llm.CallTool("lookup"), Retry: llm.NoRetry})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestResolveToolCallsConcurrently(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	release := make(chan struct{})
+	tool := llm.Tool{
+		Type:     "function",
+		Function: llm.FunctionDef{Name: "slow"},
+		Resolver: func(args json.RawMessage) (any, error) {
+			now := running.Add(1)
+			defer running.Add(-1)
+			for {
+				old := maxRunning.Load()
+				if now <= old || maxRunning.CompareAndSwap(old, now) {
+					break
+				}
+			}
+			<-release
+			return string(args), nil
+		},
+	}
+
+	toolCalls := []llm.ToolCall{}
+	for idx := range 5 {
+		toolCalls = append(toolCalls, llm.ToolCall{Id: fmt.Sprint("call_", idx), Name: "slow", Arguments: fmt.Sprint(idx)})
+	}
+
+	done := make(chan []llm.Message)
+	go func() {
+		conversation := []llm.Message{llm.User("hi"), {Role: "assistant", ToolCalls: toolCalls}}
+		done <- llm.ResolveToolCalls(conversation, llm.Options{Tools: []llm.Tool{tool}, ToolConcurrency: 2})
+	}()
+	// Wait until the limit is reached before letting the resolvers finish
+	for maxRunning.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	results := <-done
+
+	if maxRunning.Load() != 2 {
+		t.Errorf("expected at most 2 resolvers at the same time, got %d", maxRunning.Load())
+	}
+	for idx, result := range results {
+		if result.ToolCallId != toolCalls[idx].Id || result.Content != fmt.Sprintf(`"%d"`, idx) {
+			t.Errorf("expected the results in the order of the calls, got %+v at %d", result, idx)
+		}
+	}
+}
+
+func TestResolveToolCallsTimeout(t *testing.T) {
+	var gotInfo llm.ToolCallInfo
+	tools := []llm.Tool{
+		{
+			Type:     "function",
+			Function: llm.FunctionDef{Name: "slow"},
+			Timeout:  time.Millisecond * 10,
+			ContextResolver: func(ctx context.Context, call llm.ToolCallInfo, _ json.RawMessage) (any, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		},
+		{
+			Type:     "function",
+			Function: llm.FunctionDef{Name: "info"},
+			ContextResolver: func(_ context.Context, call llm.ToolCallInfo, arguments json.RawMessage) (any, error) {
+				gotInfo = call
+				// The resolver gets its own copy of the conversation
+				call.Conversation[0].Content = "changed"
+				return string(arguments), nil
+			},
+		},
+		{
+			// A resolver without a context can still time out
+			Type:     "function",
+			Function: llm.FunctionDef{Name: "stuck"},
+			Timeout:  time.Millisecond * 10,
+			Resolver: func(json.RawMessage) (any, error) {
+				time.Sleep(time.Second)
+				return "too late", nil
+			},
+		},
+	}
+	conversation := []llm.Message{
+		llm.User("hi"),
+		{Role: "assistant", ToolCalls: []llm.ToolCall{
+			{Id: "call_1", Name: "slow", Arguments: `{}`},
+			{Id: "call_2", Name: "info", Arguments: `{"a":1}`},
+			{Id: "call_3", Name: "stuck", Arguments: `{}`},
+		}},
+	}
+
+	results := llm.ResolveToolCalls(conversation, llm.Options{Tools: tools})
+	if results[0].Content != "error: timed out after 10ms" || results[2].Content != "error: timed out after 10ms" {
+		t.Errorf("expected the timeouts to be reported to the model, got %q and %q", results[0].Content, results[2].Content)
+	}
+	if results[1].Content != `"{\"a\":1}"` {
+		t.Errorf("unexpected result %q", results[1].Content)
+	}
+	if gotInfo.Id != "call_2" || gotInfo.Name != "info" || len(gotInfo.Conversation) != 2 {
+		t.Errorf("unexpected call info %+v", gotInfo)
+	}
+	if conversation[0].Content != "hi" {
+		t.Errorf("expected the resolver not to change the conversation, got %q", conversation[0].Content)
+	}
+}
+
+func TestToolLoopCancelledDuringToolCall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rounds := 0
+	tool := llm.Tool{
+		Type:     "function",
+		Function: llm.FunctionDef{Name: "lookup"},
+		ContextResolver: func(ctx context.Context, _ llm.ToolCallInfo, _ json.RawMessage) (any, error) {
+			cancel()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	loop := llm.ToolLoop{
+		Options: llm.Options{Tools: []llm.Tool{tool}, Ctx: ctx},
+		Round: func(messages []llm.Message, _ llm.Options) (llm.RoundResult, error) {
+			rounds++
+			return toolCallRound("call"), nil
+		},
+	}
+
+	_, err := loop.Run([]llm.Message{llm.User("hi")})
+	if !errors.Is(err, context.Canceled) || rounds != 1 {
+		t.Errorf("expected the loop to stop with the cancellation, got %v after %d rounds", err, rounds)
+	}
+}
+
+func TestBuiltinToolsRequireSupport(t *testing.T) {
+	sp := &stubProvider{promptFn: okPromptProvider("ok")}
+	model := &llm.Model{Name: "stub", Provider: sp}
+
+	_, err := model.Prompt([]llm.Message{llm.User("hi")}, llm.Options{Tools: []llm.Tool{{Type: "web_search"}}, Retry: llm.NoRetry})
+	if err == nil || !strings.Contains(err.Error(), "web_search") || sp.promptCalls.Load() != 0 {
+		t.Errorf("expected the built-in tool to be rejected before prompting, got %v", err)
+	}
+}
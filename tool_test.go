@@ -0,0 +1,111 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	llm "github.com/Back-to-code/go-llm"
+)
+
+type weatherArgs struct {
+	City  string   `json:"city" description:"The city name" min:"1"`
+	Unit  string   `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+	Days  int      `json:"days" min:"1" max:"7"`
+	Hours []string `json:"hours,omitempty" max:"2"`
+}
+
+type weather struct {
+	City        string `json:"city"`
+	Temperature int    `json:"temperature"`
+}
+
+func TestNewTool(t *testing.T) {
+	var gotArgs weatherArgs
+	tool, err := llm.NewTool("get_weather", "Returns the forecast", func(ctx context.Context, args weatherArgs) (weather, error) {
+		gotArgs = args
+		return weather{City: args.City, Temperature: 21}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if tool.Function.Name != "get_weather" || tool.Function.Description != "Returns the forecast" {
+		t.Errorf("unexpected function %+v", tool.Function)
+	}
+	// The string length can not be enforced by strict mode
+	if tool.Function.Strict {
+		t.Error("expected a non strict tool")
+	}
+
+	want := `{"type":"object","properties":{` +
+		`"city":{"type":"string","description":"The city name","minLength":1},` +
+		`"unit":{"type":["string","null"],"enum":["celsius","fahrenheit",null]},` +
+		`"days":{"type":"integer","minimum":1,"maximum":7},` +
+		`"hours":{"type":["array","null"],"maxItems":2,"items":{"type":"string"}}` +
+		`},"required":["city","unit","days","hours"],"additionalProperties":false}`
+	if string(tool.Function.Parameters) != want {
+		t.Errorf("unexpected parameters:\n got  %s\n want %s", tool.Function.Parameters, want)
+	}
+
+	resolve := func(arguments string) string {
+		conversation := []llm.Message{{Role: "assistant", ToolCalls: []llm.ToolCall{{Id: "call_1", Name: "get_weather", Arguments: arguments}}}}
+		return llm.ResolveToolCalls(conversation, llm.Options{Tools: []llm.Tool{tool}})[0].Content
+	}
+
+	result := resolve(`{"city":"Utrecht","unit":"celsius","days":3,"hours":null}`)
+	if result != `{"city":"Utrecht","temperature":21}` {
+		t.Errorf("unexpected result %s", result)
+	}
+	if gotArgs.City != "Utrecht" || gotArgs.Unit != "celsius" || gotArgs.Days != 3 {
+		t.Errorf("arguments were not decoded, got %+v", gotArgs)
+	}
+
+	// Optional fields may be left out
+	result = resolve(`{"city":"Utrecht","days":2}`)
+	if result != `{"city":"Utrecht","temperature":21}` || gotArgs.Unit != "" || gotArgs.Days != 2 {
+		t.Errorf("expected the optional fields to be left out, got %s with %+v", result, gotArgs)
+	}
+
+	for arguments, want := range map[string]string{
+		`{"city":"Utrecht","unit":null,"days":9,"hours":null}`:            "$.days: 9 is more than the maximum 7",
+		`{"city":"","unit":null,"days":1,"hours":null}`:                   "$.city: must be at least 1 characters",
+		`{"city":"Utrecht","unit":"kelvin","days":1,"hours":null}`:        "$.unit: kelvin is not one of celsius, fahrenheit",
+		`{"city":"Utrecht","unit":null,"days":1,"hours":["9","10","11"]}`: "$.hours: must have at most 2 items",
+		`{"unit":null,"days":1,"hours":null}`:                             `$: missing required property "city"`,
+		`{"city":"Utrecht","unit":"celsius"}`:                             `$: missing required property "days"`,
+	} {
+		result := resolve(arguments)
+		if !strings.HasPrefix(result, "error: invalid arguments: ") || !strings.Contains(result, want) {
+			t.Errorf("expected the validation error %q for %s, got %q", want, arguments, result)
+		}
+	}
+}
+
+func TestNewToolWithoutParameters(t *testing.T) {
+	tool := llm.MustNewTool("now", "Returns the time", func(ctx context.Context, args struct{}) (string, error) {
+		return "12:00", nil
+	})
+	conversation := []llm.Message{{Role: "assistant", ToolCalls: []llm.ToolCall{{Id: "call_1", Name: "now"}}}}
+	result := llm.ResolveToolCalls(conversation, llm.Options{Tools: []llm.Tool{tool}})[0].Content
+	if result != `"12:00"` {
+		t.Errorf("expected the missing arguments to be accepted, got %s", result)
+	}
+
+	var schema map[string]any
+	json.Unmarshal(tool.Function.Parameters, &schema)
+	if schema["type"] != "object" {
+		t.Errorf("unexpected parameters %s", tool.Function.Parameters)
+	}
+}
+
+func TestNewToolUnsupportedArgs(t *testing.T) {
+	_, err := llm.NewTool("bad", "", func(ctx context.Context, args struct {
+		Values map[int]string `json:"values"`
+	}) (string, error) {
+		return "", nil
+	})
+	if err == nil {
+		t.Error("expected an error for arguments without a json schema")
+	}
+}